@@ -1,21 +1,26 @@
 package main
 
 import (
+	"context"
+	"html/template"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v5"
 	"github.com/patrickmn/go-cache"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
-	"github.com/pocketbase/pocketbase/models"
 	"github.com/pocketbase/pocketbase/tokens"
 
 	"github.com/harperreed/micropub-service/internal/config"
 	"github.com/harperreed/micropub-service/internal/events"
+	"github.com/harperreed/micropub-service/internal/forge"
 	"github.com/harperreed/micropub-service/internal/git"
+	"github.com/harperreed/micropub-service/internal/indieauth"
 	"github.com/harperreed/micropub-service/internal/micropub"
+	"github.com/harperreed/micropub-service/internal/scheduler"
 )
 
 var userRoleCache *cache.Cache
@@ -35,20 +40,49 @@ func setupFileCleanup(emitter *events.EventEmitter) {
 func roleAuthorization(allowedRoles ...string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			user, _ := c.Get("user").(*models.Record)
-
-			if user == nil {
-				return c.String(http.StatusUnauthorized, "You must be logged in to access this resource")
+			// Tokens issued by the built-in IndieAuth server carry the current
+			// role of the user who approved them. Tokens verified by a remote token
+			// endpoint have no role; they were issued to the site owner.
+			var userRole string
+			if token := micropub.TokenFromContext(c); token != nil {
+				if token.Role == "" {
+					return next(c)
+				}
+				userRole = token.Role
+			} else {
+				userID, ok := currentUser(c)
+				if !ok {
+					return micropub.WriteError(c, micropub.Unauthorized("You must be logged in to access this resource"))
+				}
+				userRole = getUserRole(userID)
 			}
 
-			userRole := getUserRole(user.Id)
 			for _, role := range allowedRoles {
 				if userRole == role {
 					return next(c)
 				}
 			}
 
-			return c.String(http.StatusForbidden, "You are not authorized to access this resource")
+			return micropub.WriteError(c, micropub.Forbidden("You are not authorized to access this resource"))
+		}
+	}
+}
+
+// actionAuthorization checks the role of the user for the action of a POST
+// request to the Micropub endpoint: as through DELETE, only admins can delete
+// and undelete posts.
+func actionAuthorization() echo.MiddlewareFunc {
+	editors := roleAuthorization(roleAdmin, roleEditor)
+	admins := roleAuthorization(roleAdmin)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		forEditors, forAdmins := editors(next), admins(next)
+		return func(c echo.Context) error {
+			switch micropub.RequestAction(c) {
+			case "delete", "undelete":
+				return forAdmins(c)
+			default:
+				return forEditors(c)
+			}
 		}
 	}
 }
@@ -59,8 +93,15 @@ func getUserRole(userId string) string {
 	}
 
 	// If not found in cache, fetch from database and cache it
-	// This is a placeholder - replace with actual database query
-	role := "user" // Default role
+	role, err := roleLookup(userId)
+	if err != nil {
+		// Failures are not cached so the lookup is retried on the next request
+		log.Printf("Failed to look up role of user %s: %v", userId, err)
+		return ""
+	}
+	if role == "" {
+		role = roleUser
+	}
 	userRoleCache.Set(userId, role, cache.DefaultExpiration)
 	return role
 }
@@ -90,7 +131,10 @@ func handleLogin(c echo.Context) error {
 	}
 
 	// Cache the user's role
-	role := authRecord.Get("role").(string) // Assuming the role is stored in a "role" field
+	role := authRecord.GetString("role")
+	if role == "" {
+		role = roleUser
+	}
 	userRoleCache.Set(authRecord.Id, role, cache.DefaultExpiration)
 
 	c.SetCookie(&http.Cookie{
@@ -102,11 +146,33 @@ func handleLogin(c echo.Context) error {
 		SameSite: http.SameSiteStrictMode,
 	})
 
+	// Return to the page that required the login, e.g. the IndieAuth consent screen
+	if next := c.FormValue("next"); isLocalPath(next) {
+		return c.Redirect(http.StatusSeeOther, next)
+	}
+
 	return c.JSON(http.StatusOK, map[string]string{
 		"token": token,
 		"role":  role,
 	})
 }
+
+// isLocalPath reports whether next is a path on this server, so that login
+// redirects cannot be used to send users to another site.
+func isLocalPath(next string) bool {
+	return strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//") && !strings.HasPrefix(next, "/\\")
+}
+
+// withApp makes the PocketBase app available to handlers as c.Get("app").
+func withApp(app *pocketbase.PocketBase) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("app", app)
+			return next(c)
+		}
+	}
+}
+
 func main() {
 	// Load configuration
 	cfg, err := config.Load()
@@ -116,12 +182,60 @@ func main() {
 
 	// Use the configuration
 	log.Printf("Git repository path: %s", cfg.GitRepoPath)
+	git.RepoPath = cfg.GitRepoPath
+	if git.Repo, err = git.NewBackend(cfg.GitBackend); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if git.ActiveProfile, err = git.LookupProfile(cfg.Profile); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if git.ActiveProfile.MediaDir != "" {
+		git.MediaDir = git.ActiveProfile.MediaDir
+	}
+	git.Layouts = cfg.Layouts
+	git.PostURL = cfg.PostURL
+	git.PermalinkBase = cfg.PermalinkBase
+	git.PropertyMap = cfg.PropertyMap
+	git.DraftKey = cfg.DraftKey
+	git.DraftLayout = cfg.DraftLayout
+	format := cfg.FrontmatterFormat
+	if format == "" {
+		format = string(git.ActiveProfile.Format)
+	}
+	if git.FrontmatterFormat, err = git.ParseFormat(format); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	git.CommitAuthor = git.Signature(cfg.Commit.Author)
+	git.CommitCommitter = git.Signature(cfg.Commit.Committer)
+	if git.CommitAttribution, err = git.ParseAttribution(cfg.Commit.Attribution); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if git.CommitMessages, err = git.ParseCommitMessages(cfg.Commit.Messages); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	switch cfg.Publish.Mode {
+	case "", config.PublishPush:
+	case config.PublishPullRequest:
+		forgeCfg := cfg.Publish.Forge
+		if git.Forge, err = forge.New(forgeCfg.Type, forgeCfg.URL, forgeCfg.Repository, forgeCfg.Token); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		if cfg.Publish.BranchPrefix != "" {
+			git.BranchPrefix = cfg.Publish.BranchPrefix
+		}
+	default:
+		log.Fatalf("Invalid configuration: unsupported publish mode %q, expected %q or %q", cfg.Publish.Mode, config.PublishPush, config.PublishPullRequest)
+	}
 
 	app := pocketbase.New()
+	roleLookup = pocketBaseRoleLookup(app)
+	currentUser = sessionUser(app)
+	registerRoleHooks(app)
 
 	// Initialize event emitter
 	eventEmitter := events.NewEventEmitter()
 	micropub.SetEventEmitter(eventEmitter)
+	micropub.SetConfig(cfg)
 
 	// Initialize Git repository
 	if err := git.InitializeRepo(); err != nil {
@@ -131,14 +245,77 @@ func main() {
 	// Set up file cleanup process
 	setupFileCleanup(eventEmitter)
 
+	// Hold posts published in the future until their time comes. The queue is
+	// kept in PocketBase so that it survives restarts.
+	scheduleStore := scheduler.NewPocketBaseStore(app)
+	postScheduler := scheduler.New(git.GitOps, scheduleStore, eventEmitter)
+	git.GitOps = postScheduler
+	eventEmitter.On("publish", func(event interface{}) {
+		publishEvent := event.(events.PublishEvent)
+		log.Printf("Scheduled post published: %s", publishEvent.URL)
+	})
+	eventEmitter.On("publish_failed", func(event interface{}) {
+		failed := event.(events.PublishFailedEvent)
+		log.Printf("Giving up on scheduled post %s (%s) after %d attempts, it is left in the queue: %s", failed.ID, failed.URL, failed.Attempts, failed.Error)
+	})
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	app.OnTerminate().Add(func(e *core.TerminateEvent) error {
+		stopScheduler()
+		return nil
+	})
+
+	// Verify IndieAuth bearer tokens with the built-in server when enabled,
+	// otherwise with the configured token endpoint
+	var verifier indieauth.Verifier
+	var authServer *indieauth.Server
+	authStore := indieauth.NewPocketBaseStore(app)
+	if cfg.IndieAuthIssuer != "" {
+		consent, err := template.ParseFiles("templates/consent.html")
+		if err != nil {
+			log.Fatalf("Failed to load consent template: %v", err)
+		}
+		me := cfg.Me
+		if me == "" {
+			me = strings.TrimRight(cfg.IndieAuthIssuer, "/") + "/"
+		}
+		authServer = indieauth.NewServer(cfg.IndieAuthIssuer, me, authStore, sessionUser(app), consent)
+		authServer.UserRole = getUserRole
+		authServer.ApproverRoles = []string{roleAdmin, roleEditor}
+		verifier = authServer
+	} else if cfg.TokenEndpoint != "" {
+		verifier = indieauth.NewEndpointVerifier(cfg.TokenEndpoint, cfg.Me)
+	}
+	tokenAuth := micropub.TokenAuthorization(verifier)
+
 	app.OnBeforeServe().Add(func(e *core.ServeEvent) error {
-		e.Router.POST("/micropub", echo.HandlerFunc(micropub.HandleMicropubCreate), roleAuthorization("admin", "editor"))
-		e.Router.PUT("/micropub", echo.HandlerFunc(micropub.HandleMicropubUpdate), roleAuthorization("admin", "editor"))
-		e.Router.DELETE("/micropub", echo.HandlerFunc(micropub.HandleMicropubDelete), roleAuthorization("admin"))
+		if err := ensureRoleField(app); err != nil {
+			return err
+		}
+
+		if err := scheduleStore.EnsureCollection(); err != nil {
+			return err
+		}
+		go postScheduler.Run(schedulerCtx)
+
+		if authServer != nil {
+			if err := authStore.EnsureCollections(); err != nil {
+				return err
+			}
+			authServer.Register(e.Router)
+		}
+
+		e.Router.GET("/micropub", echo.HandlerFunc(micropub.HandleMicropubQuery), tokenAuth, roleAuthorization("admin", "editor"))
+		e.Router.POST("/micropub", echo.HandlerFunc(micropub.HandleMicropubPost), tokenAuth, actionAuthorization())
+		e.Router.PUT("/micropub", echo.HandlerFunc(micropub.HandleMicropubUpdate), tokenAuth, roleAuthorization("admin", "editor"))
+		e.Router.DELETE("/micropub", echo.HandlerFunc(micropub.HandleMicropubDelete), tokenAuth, roleAuthorization("admin"))
 
 		// Add routes for login
 		e.Router.GET("/login", echo.HandlerFunc(handleLoginPage))
-		e.Router.POST("/login", echo.HandlerFunc(handleLogin))
+		e.Router.POST("/login", echo.HandlerFunc(handleLogin), withApp(app))
+
+		// Add routes for role management
+		e.Router.GET("/admin/users", echo.HandlerFunc(handleListUserRoles), withApp(app), roleAuthorization("admin"))
+		e.Router.PUT("/admin/users/:id/role", echo.HandlerFunc(handleSetUserRole), withApp(app), roleAuthorization("admin"))
 
 		return nil
 	})
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/harperreed/micropub-service/internal/micropub"
+)
+
+// Roles a user can have. Users without a role are treated as roleUser.
+const (
+	roleAdmin  = "admin"
+	roleEditor = "editor"
+	roleUser   = "user"
+)
+
+var roles = []string{roleAdmin, roleEditor, roleUser}
+
+// roleLookup fetches the role of a user from the users collection. It is a
+// variable so tests can replace it.
+var roleLookup = func(userID string) (string, error) {
+	return "", errors.New("role lookup is not configured")
+}
+
+// currentUser returns the ID of the user making the request, if logged in.
+var currentUser = func(c echo.Context) (string, bool) {
+	return "", false
+}
+
+// pocketBaseRoleLookup reads the "role" field of the user record.
+func pocketBaseRoleLookup(app *pocketbase.PocketBase) func(string) (string, error) {
+	return func(userID string) (string, error) {
+		record, err := app.Dao().FindRecordById("users", userID)
+		if err != nil {
+			return "", err
+		}
+		return record.GetString("role"), nil
+	}
+}
+
+// sessionUser authenticates the user by the PocketBase auth token sent in the
+// Authorization header, or by the cookie set by handleLogin.
+func sessionUser(app *pocketbase.PocketBase) func(echo.Context) (string, bool) {
+	return func(c echo.Context) (string, bool) {
+		if record, _ := c.Get(apis.ContextAuthRecordKey).(*models.Record); record != nil {
+			return record.Id, true
+		}
+
+		cookie, err := c.Cookie("pb_auth")
+		if err != nil || cookie.Value == "" {
+			return "", false
+		}
+		record, err := app.Dao().FindAuthRecordByToken(cookie.Value, app.Settings().RecordAuthToken.Secret)
+		if err != nil {
+			return "", false
+		}
+		return record.Id, true
+	}
+}
+
+func isValidRole(role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidateUserRole drops the cached role of a user so it is read again on
+// the next request.
+func invalidateUserRole(userID string) {
+	userRoleCache.Delete(userID)
+}
+
+// registerRoleHooks keeps the role cache in sync with changes to user records,
+// whether they come from the role API or the PocketBase admin UI.
+func registerRoleHooks(app *pocketbase.PocketBase) {
+	invalidate := func(e *core.ModelEvent) error {
+		invalidateUserRole(e.Model.GetId())
+		return nil
+	}
+	app.OnModelAfterUpdate("users").Add(invalidate)
+	app.OnModelAfterDelete("users").Add(invalidate)
+}
+
+// roleUnset is the API rule condition that rejects requests setting a role.
+const roleUnset = "@request.data.role:isset = false"
+
+// ensureRoleField adds the "role" select field to the users collection if it
+// does not exist yet, and makes sure users cannot set their own role through
+// the records API. Only handleSetUserRole and PocketBase admins change roles.
+func ensureRoleField(app core.App) error {
+	users, err := app.Dao().FindCollectionByNameOrId("users")
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	if users.Schema.GetFieldByName("role") == nil {
+		users.Schema.AddField(&schema.SchemaField{
+			Name:    "role",
+			Type:    schema.FieldTypeSelect,
+			Options: &schema.SelectOptions{MaxSelect: 1, Values: roles},
+		})
+		changed = true
+	}
+	for _, rule := range []**string{&users.CreateRule, &users.UpdateRule} {
+		if locked := lockRoleRule(*rule); locked != *rule {
+			*rule = locked
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return app.Dao().SaveCollection(users)
+}
+
+// lockRoleRule adds roleUnset to an API rule. A nil rule only lets admins
+// through already and is returned as is, as is a rule that is already locked.
+func lockRoleRule(rule *string) *string {
+	switch {
+	case rule == nil || strings.Contains(*rule, roleUnset):
+		return rule
+	case strings.TrimSpace(*rule) == "":
+		return types.Pointer(roleUnset)
+	default:
+		return types.Pointer("(" + *rule + ") && " + roleUnset)
+	}
+}
+
+// userRole is the representation of a user in the role API.
+type userRole struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+func newUserRole(record *models.Record) userRole {
+	role := record.GetString("role")
+	if role == "" {
+		role = roleUser
+	}
+	return userRole{ID: record.Id, Email: record.Email(), Role: role}
+}
+
+// handleListUserRoles lists all users with their roles.
+func handleListUserRoles(c echo.Context) error {
+	app := c.Get("app").(*pocketbase.PocketBase)
+
+	records, err := app.Dao().FindRecordsByExpr("users")
+	if err != nil {
+		return micropub.WriteError(c, micropub.ServerError("Failed to list users"))
+	}
+
+	users := make([]userRole, 0, len(records))
+	for _, record := range records {
+		users = append(users, newUserRole(record))
+	}
+	return c.JSON(http.StatusOK, users)
+}
+
+// handleSetUserRole changes the role of a user.
+func handleSetUserRole(c echo.Context) error {
+	app := c.Get("app").(*pocketbase.PocketBase)
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return micropub.WriteError(c, micropub.InvalidRequest("Invalid request body"))
+	}
+	if !isValidRole(body.Role) {
+		return micropub.WriteError(c, micropub.InvalidRequest("Role must be one of admin, editor or user"))
+	}
+
+	record, err := app.Dao().FindRecordById("users", c.PathParam("id"))
+	if err != nil {
+		return micropub.WriteError(c, micropub.NewError(http.StatusNotFound, micropub.ErrInvalidRequest, "User not found"))
+	}
+
+	record.Set("role", body.Role)
+	if err := app.Dao().SaveRecord(record); err != nil {
+		return micropub.WriteError(c, micropub.ServerError("Failed to save role"))
+	}
+	log.Printf("Role of user %s changed to %s", record.Id, body.Role)
+
+	return c.JSON(http.StatusOK, newUserRole(record))
+}
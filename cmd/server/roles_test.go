@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+
+	"github.com/harperreed/micropub-service/internal/indieauth"
+	"github.com/harperreed/micropub-service/internal/micropub"
+)
+
+// stubRoles replaces the role lookup and session user for the duration of a test.
+func stubRoles(t *testing.T, userRoles map[string]string, loggedIn string) *int {
+	t.Helper()
+
+	lookups := 0
+	originalLookup, originalUser := roleLookup, currentUser
+	roleLookup = func(userID string) (string, error) {
+		lookups++
+		role, ok := userRoles[userID]
+		if !ok {
+			return "", errors.New("user not found")
+		}
+		return role, nil
+	}
+	currentUser = func(c echo.Context) (string, bool) {
+		return loggedIn, loggedIn != ""
+	}
+	userRoleCache.Flush()
+
+	t.Cleanup(func() {
+		roleLookup, currentUser = originalLookup, originalUser
+		userRoleCache.Flush()
+	})
+	return &lookups
+}
+
+func TestGetUserRole(t *testing.T) {
+	userRoles := map[string]string{"alice": "editor", "bob": ""}
+	lookups := stubRoles(t, userRoles, "")
+
+	if role := getUserRole("alice"); role != "editor" {
+		t.Errorf("getUserRole() = %q, want %q", role, "editor")
+	}
+	getUserRole("alice")
+	if *lookups != 1 {
+		t.Errorf("expected role to be cached; looked up %d times", *lookups)
+	}
+
+	// Changing the record invalidates the cached role
+	userRoles["alice"] = "admin"
+	invalidateUserRole("alice")
+	if role := getUserRole("alice"); role != "admin" {
+		t.Errorf("getUserRole() after invalidation = %q, want %q", role, "admin")
+	}
+
+	if role := getUserRole("bob"); role != roleUser {
+		t.Errorf("getUserRole() without role = %q, want %q", role, roleUser)
+	}
+
+	if role := getUserRole("mallory"); role != "" {
+		t.Errorf("getUserRole() for unknown user = %q, want empty", role)
+	}
+	if _, cached := userRoleCache.Get("mallory"); cached {
+		t.Errorf("expected failed lookups not to be cached")
+	}
+}
+
+func TestRoleAuthorization(t *testing.T) {
+	e := echo.New()
+	userRoles := map[string]string{"alice": "editor", "carol": "admin"}
+
+	tests := []struct {
+		name     string
+		loggedIn string
+		want     int
+	}{
+		{"NotLoggedIn", "", http.StatusUnauthorized},
+		{"WrongRole", "alice", http.StatusForbidden},
+		{"AllowedRole", "carol", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubRoles(t, userRoles, tt.loggedIn)
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+			rec := httptest.NewRecorder()
+			handler := roleAuthorization("admin")(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+			if err := handler(e.NewContext(req, rec)); err != nil {
+				t.Fatalf("middleware returned error: %v", err)
+			}
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+// stubVerifier accepts any access token as the given token.
+type stubVerifier struct {
+	token indieauth.Token
+}
+
+func (v stubVerifier) Verify(ctx context.Context, token string) (*indieauth.Token, error) {
+	result := v.token
+	return &result, nil
+}
+
+func TestRoleAuthorizationWithToken(t *testing.T) {
+	e := echo.New()
+	stubRoles(t, nil, "")
+
+	tests := []struct {
+		name string
+		role string
+		want int
+	}{
+		// Tokens of a remote token endpoint belong to the site owner
+		{"RemoteEndpoint", "", http.StatusOK},
+		{"WrongRole", "editor", http.StatusForbidden},
+		{"AllowedRole", "admin", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := stubVerifier{indieauth.Token{Me: "https://example.com/", Scope: "delete", Role: tt.role}}
+			handler := micropub.TokenAuthorization(verifier)(roleAuthorization("admin")(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodDelete, "/micropub", nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			if err := handler(e.NewContext(req, rec)); err != nil {
+				t.Fatalf("middleware returned error: %v", err)
+			}
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestActionAuthorization(t *testing.T) {
+	e := echo.New()
+	stubRoles(t, nil, "")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"Create", echo.MIMEApplicationJSON, `{"type":["h-entry"],"properties":{"content":["Hi"]}}`, http.StatusOK},
+		{"Update", echo.MIMEApplicationJSON, `{"action":"update","url":"/post.md"}`, http.StatusOK},
+		{"Delete", echo.MIMEApplicationJSON, `{"action":"delete","url":"/post.md"}`, http.StatusForbidden},
+		{"FormUndelete", echo.MIMEApplicationForm, "action=undelete&url=/post.md", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := stubVerifier{indieauth.Token{Me: "https://example.com/", Scope: "create update delete", Role: "editor"}}
+			handler := micropub.TokenAuthorization(verifier)(actionAuthorization()(func(c echo.Context) error {
+				// The body is left for the handler
+				body, _ := io.ReadAll(c.Request().Body)
+				if tt.contentType == echo.MIMEApplicationJSON && string(body) != tt.body {
+					t.Errorf("handler read body %q, want %q", body, tt.body)
+				}
+				return c.NoContent(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			if err := handler(e.NewContext(req, rec)); err != nil {
+				t.Fatalf("middleware returned error: %v", err)
+			}
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsValidRole(t *testing.T) {
+	for _, role := range []string{"admin", "editor", "user"} {
+		if !isValidRole(role) {
+			t.Errorf("isValidRole(%q) = false", role)
+		}
+	}
+	if isValidRole("root") {
+		t.Errorf("isValidRole(%q) = true", "root")
+	}
+}
+
+func TestLockRoleRule(t *testing.T) {
+	rule := func(s string) *string { return &s }
+
+	tests := []struct {
+		name string
+		rule *string
+		want *string
+	}{
+		{"AdminsOnly", nil, nil},
+		{"Everyone", rule(""), rule("@request.data.role:isset = false")},
+		{"Owner", rule("id = @request.auth.id"), rule("(id = @request.auth.id) && @request.data.role:isset = false")},
+		{"Locked", rule("(id = @request.auth.id) && @request.data.role:isset = false"), rule("(id = @request.auth.id) && @request.data.role:isset = false")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lockRoleRule(tt.rule)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("lockRoleRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,12 +6,208 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 )
 
 // Config represents the application configuration.
 type Config struct {
 	// GitRepoPath is the path to the Git repository.
 	GitRepoPath string `json:"gitRepoPath"`
+
+	// GitBackend selects how the repository is driven: "cli" (the default)
+	// runs the git binary, "go-git" works in-process without it.
+	GitBackend string `json:"gitBackend"`
+
+	// PermalinkBase is the public base URL of the site, used to build the
+	// absolute URLs of created posts (e.g. "https://example.com").
+	PermalinkBase string `json:"permalinkBase"`
+
+	// TokenEndpoint is the IndieAuth token endpoint used to verify bearer tokens.
+	// Token verification is disabled when empty.
+	TokenEndpoint string `json:"tokenEndpoint"`
+
+	// Me is the URL of the site owner. Only tokens issued for this URL are
+	// accepted, so it is required with TokenEndpoint.
+	Me string `json:"me"`
+
+	// IndieAuthIssuer is the public base URL of this server. When set, the
+	// built-in IndieAuth authorization and token endpoints are enabled and
+	// used to verify bearer tokens instead of TokenEndpoint.
+	IndieAuthIssuer string `json:"indieAuthIssuer"`
+
+	// MediaEndpoint is the public URL of the Micropub media endpoint.
+	MediaEndpoint string `json:"mediaEndpoint"`
+
+	// SyndicateTo lists the syndication targets offered to Micropub clients.
+	SyndicateTo []SyndicationTarget `json:"syndicateTo"`
+
+	// PostTypes lists the post types advertised to Micropub clients.
+	// When empty, DefaultPostTypes is used.
+	PostTypes []PostType `json:"postTypes"`
+
+	// Profile selects the static site generator posts are written for:
+	// "hugo", "jekyll", "eleventy" or "astro". The profile supplies the
+	// frontmatter format, key names, draft handling, layouts and media
+	// directory; the settings below override it.
+	Profile string `json:"profile"`
+
+	// Layouts maps post types (e.g. "note", "article", "photo") to the
+	// location of their files in the repository. Post types without a layout
+	// use the "default" entry, or YYYY-MM-DD-slug.md in the repository root.
+	Layouts map[string]Layout `json:"layouts"`
+
+	// PropertyMap maps Micropub properties to frontmatter keys, e.g.
+	// {"category": "tags"}. A key of "-" leaves the property out.
+	PropertyMap map[string]string `json:"propertyMap"`
+
+	// DraftKey is the frontmatter key set to true on drafts. Defaults to the
+	// key of the profile, or "draft" when drafts have no layout of their own.
+	DraftKey string `json:"draftKey"`
+
+	// DraftLayout, when set, is where drafts are written instead of the
+	// layout of their post type, e.g. {"path": "_drafts/{slug}.md"}.
+	// Publishing a draft moves it to the layout of its post type.
+	DraftLayout Layout `json:"draftLayout"`
+
+	// ClientDefaults maps client IDs to properties added to the posts they
+	// create when missing, e.g. {"https://quill.p3k.io/": {"post-status":
+	// ["draft"]}} to keep posts from that client as drafts.
+	ClientDefaults map[string]map[string][]interface{} `json:"clientDefaults"`
+
+	// FrontmatterFormat is the frontmatter format of new posts: "yaml"
+	// (the default), "toml" or "json". Defaults to the format of the profile.
+	FrontmatterFormat string `json:"frontmatterFormat"`
+
+	// Commit configures the commits made for posts.
+	Commit CommitConfig `json:"commit"`
+
+	// Publish configures how commits reach the remote repository.
+	Publish PublishConfig `json:"publish"`
+}
+
+// Publish modes.
+const (
+	PublishPush        = "push"
+	PublishPullRequest = "pull-request"
+)
+
+// PublishConfig configures how commits reach the remote repository.
+type PublishConfig struct {
+	// Mode is "push" (the default) to push commits to the current branch, or
+	// "pull-request" to push the commits of each request to a branch of its
+	// own and open a pull request for it on Forge.
+	Mode string `json:"mode"`
+
+	// BranchPrefix is prepended to the names of the branches pull requests
+	// are opened from. Defaults to "micropub/".
+	BranchPrefix string `json:"branchPrefix"`
+
+	// Forge is where pull requests are opened.
+	Forge ForgeConfig `json:"forge"`
+}
+
+// ForgeConfig identifies a repository on a Git hosting service.
+type ForgeConfig struct {
+	// Type is "github", "gitea" or "gitlab".
+	Type string `json:"type"`
+
+	// URL is the base URL of the API. Defaults to https://api.github.com for
+	// GitHub and https://gitlab.com for GitLab; required for Gitea.
+	URL string `json:"url"`
+
+	// Repository is the repository as "owner/name", or the path or ID of a
+	// GitLab project.
+	Repository string `json:"repository"`
+
+	// Token is the access token used to open pull requests.
+	Token string `json:"token"`
+}
+
+// CommitConfig configures the author, committer and messages of commits.
+type CommitConfig struct {
+	// Author is the author of commits. Defaults to the user of the Git
+	// configuration.
+	Author Identity `json:"author"`
+
+	// Committer is the committer of commits. Defaults to the user of the Git
+	// configuration.
+	Committer Identity `json:"committer"`
+
+	// Attribution, when "me" or "client", names the authenticated user or
+	// the Micropub client as the author of the commits made on their
+	// behalf, keeping the email of Author.
+	Attribution string `json:"attribution"`
+
+	// Messages maps actions ("create", "update", "delete", "undelete",
+	// "publish" and "unpublish") to Go templates of their commit messages,
+	// e.g. {"create": "Add {{.Type}} {{.Slug}} via {{.Client}}"}. Templates
+	// may use .Action, .Type, .Title, .Slug, .Path, .URL, .Me, .ClientID and
+	// .Client.
+	Messages map[string]string `json:"messages"`
+}
+
+// Identity is the name and email of a commit author or committer.
+type Identity struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Layout describes where the files of a post type are written. Templates may
+// use the tokens {year}, {month}, {day}, {hour}, {minute}, {second}, {slug},
+// {id} and {type}.
+type Layout struct {
+	// Path is the template of the post file, relative to the repository,
+	// e.g. "content/notes/{year}/{slug}.md".
+	Path string `json:"path"`
+
+	// Media is the template of the directory media uploaded with the post is
+	// stored in. It may also use {dir}, the directory of the post, to keep
+	// media in page bundles. Defaults to the shared media directory.
+	Media string `json:"media"`
+}
+
+// PostURL returns the absolute public URL of the post at path. Paths that are
+// already absolute URLs are returned unchanged.
+func (c *Config) PostURL(path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	if c.PermalinkBase == "" {
+		return path
+	}
+	return strings.TrimRight(c.PermalinkBase, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// SyndicationTarget describes a destination a post can be syndicated to.
+type SyndicationTarget struct {
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+}
+
+// PostType describes a post type supported by the server.
+type PostType struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// DefaultPostTypes is the list of post types advertised when none are configured.
+var DefaultPostTypes = []PostType{
+	{Type: "note", Name: "Note"},
+	{Type: "article", Name: "Article"},
+	{Type: "photo", Name: "Photo"},
+	{Type: "reply", Name: "Reply"},
+	{Type: "like", Name: "Like"},
+	{Type: "repost", Name: "Repost"},
+	{Type: "bookmark", Name: "Bookmark"},
+	{Type: "checkin", Name: "Checkin"},
+}
+
+// SupportedPostTypes returns the configured post types, falling back to DefaultPostTypes.
+func (c *Config) SupportedPostTypes() []PostType {
+	if len(c.PostTypes) > 0 {
+		return c.PostTypes
+	}
+	return DefaultPostTypes
 }
 
 // Load reads the configuration from a JSON file and returns a Config struct.
@@ -42,6 +238,11 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("GitRepoPath is required in the configuration")
 	}
 
+	if config.TokenEndpoint != "" && config.Me == "" {
+		log.Println("Me is empty in the config file while TokenEndpoint is set")
+		return nil, fmt.Errorf("Me is required in the configuration when TokenEndpoint is set")
+	}
+
 	log.Println("Configuration loaded successfully")
 	return &config, nil
 }
@@ -55,6 +55,25 @@ func TestLoad(t *testing.T) {
 		assert.Nil(t, config)
 		assert.Contains(t, err.Error(), "GitRepoPath is required")
 	})
+
+	// Test loading a token endpoint without the URL of the site owner
+	t.Run("TokenEndpointWithoutMe", func(t *testing.T) {
+		tokenConfig := Config{GitRepoPath: "/path/to/repo", TokenEndpoint: "https://tokens.indieauth.com/token"}
+		tokenConfigData, err := json.Marshal(tokenConfig)
+		require.NoError(t, err)
+		err = os.WriteFile(configPath, tokenConfigData, 0644)
+		require.NoError(t, err)
+
+		oldWd, _ := os.Getwd()
+		err = os.Chdir(tempDir)
+		require.NoError(t, err)
+		defer os.Chdir(oldWd)
+
+		config, err := Load()
+		assert.Error(t, err)
+		assert.Nil(t, config)
+		assert.Contains(t, err.Error(), "Me is required")
+	})
 }
 
 func TestLoadNonExistentFile(t *testing.T) {
@@ -115,3 +134,24 @@ func TestConfigStruct(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, config, unmarshaledConfig)
 }
+
+func TestPostURL(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		path string
+		want string
+	}{
+		{"RelativePath", "https://example.com", "/2024-01-01-post.md", "https://example.com/2024-01-01-post.md"},
+		{"TrailingSlashBase", "https://example.com/blog/", "/post.md", "https://example.com/blog/post.md"},
+		{"NoBase", "", "/post.md", "/post.md"},
+		{"AbsoluteURL", "https://example.com", "https://other.example/post", "https://other.example/post"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{PermalinkBase: tt.base}
+			assert.Equal(t, tt.want, config.PostURL(tt.path))
+		})
+	}
+}
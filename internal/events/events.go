@@ -2,6 +2,7 @@ package events
 
 import (
 	"sync"
+	"time"
 )
 
 type EventEmitter struct {
@@ -36,6 +37,10 @@ func GetEventType(event interface{}) string {
 	switch event.(type) {
 	case FileEvent:
 		return "file"
+	case PublishEvent:
+		return "publish"
+	case PublishFailedEvent:
+		return "publish_failed"
 	default:
 		return "unknown"
 	}
@@ -45,3 +50,24 @@ type FileEvent struct {
 	Type     string
 	Filename string
 }
+
+// PublishEvent is emitted when a scheduled post goes live.
+type PublishEvent struct {
+	// URL is the URL of the post, relative to the site.
+	URL string
+	// PublishedAt is the publication date of the post.
+	PublishedAt time.Time
+}
+
+// PublishFailedEvent is emitted when a scheduled post fails to publish for
+// the last time, and is left in the queue.
+type PublishFailedEvent struct {
+	// ID identifies the post in the queue.
+	ID string
+	// URL is the URL the post was to have, relative to the site.
+	URL string
+	// Attempts is how many times publishing the post was attempted.
+	Attempts int
+	// Error is the error of the last attempt.
+	Error string
+}
@@ -94,6 +94,8 @@ func TestGetEventType(t *testing.T) {
 		expected string
 	}{
 		{"FileEvent", FileEvent{Type: "test", Filename: "test.txt"}, "file"},
+		{"PublishEvent", PublishEvent{URL: "/post.md"}, "publish"},
+		{"PublishFailedEvent", PublishFailedEvent{URL: "/post.md"}, "publish_failed"},
 		{"UnknownEvent", struct{}{}, "unknown"},
 	}
 
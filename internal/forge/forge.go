@@ -0,0 +1,128 @@
+// Package forge opens pull requests on Git hosting services.
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Supported forges.
+const (
+	GitHub = "github"
+	Gitea  = "gitea"
+	GitLab = "gitlab"
+)
+
+// PullRequest describes a pull request to open.
+type PullRequest struct {
+	// Title is the title of the pull request.
+	Title string
+	// Body is the description of the pull request.
+	Body string
+	// Head is the branch with the changes.
+	Head string
+	// Base is the branch the changes are to be merged into.
+	Base string
+}
+
+// Client opens pull requests on a repository.
+type Client interface {
+	// CreatePullRequest opens pr and returns its web URL.
+	CreatePullRequest(ctx context.Context, pr PullRequest) (string, error)
+}
+
+// New returns a client for the repository called repository on the forge
+// of the given kind. baseURL is the URL of the forge, and may be empty for
+// GitHub and GitLab to use their public instances. repository is
+// "owner/name", or the path or ID of a GitLab project.
+func New(kind, baseURL, repository, token string) (Client, error) {
+	if repository == "" {
+		return nil, fmt.Errorf("missing %s repository", kind)
+	}
+	api := apiClient{
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+
+	switch strings.ToLower(kind) {
+	case GitHub:
+		if baseURL == "" {
+			baseURL = "https://api.github.com"
+		}
+		api.baseURL = strings.TrimRight(baseURL, "/")
+		return &GitHubClient{api: api, Repository: repository}, nil
+	case Gitea:
+		if baseURL == "" {
+			return nil, fmt.Errorf("missing Gitea URL")
+		}
+		api.baseURL = strings.TrimRight(baseURL, "/")
+		return &GiteaClient{api: api, Repository: repository}, nil
+	case GitLab:
+		if baseURL == "" {
+			baseURL = "https://gitlab.com"
+		}
+		api.baseURL = strings.TrimRight(baseURL, "/")
+		return &GitLabClient{api: api, Project: repository}, nil
+	default:
+		return nil, fmt.Errorf("unsupported forge %q, expected %q, %q or %q", kind, GitHub, Gitea, GitLab)
+	}
+}
+
+// apiClient makes the JSON requests shared by the forge clients.
+type apiClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// post sends payload as JSON to path, with the headers set by auth, and
+// decodes the response into result.
+func (a apiClient) post(ctx context.Context, path string, auth func(*http.Request), payload, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	auth(req)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach forge: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return apiError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode forge response: %w", err)
+	}
+	return nil
+}
+
+// apiError returns an error with the status of resp and the message the
+// forge sent along, if any.
+func apiError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var body struct {
+		Message interface{} `json:"message"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Message != nil {
+		return fmt.Errorf("forge returned status %d: %v", resp.StatusCode, body.Message)
+	}
+	if msg := strings.TrimSpace(string(data)); msg != "" {
+		return fmt.Errorf("forge returned status %d: %s", resp.StatusCode, msg)
+	}
+	return fmt.Errorf("forge returned status %d", resp.StatusCode)
+}
@@ -0,0 +1,77 @@
+package forge
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/harperreed/micropub-service/internal/forge/forgetest"
+)
+
+func TestCreatePullRequest(t *testing.T) {
+	server := forgetest.NewServer()
+	defer server.Close()
+
+	tests := []struct {
+		kind       string
+		repository string
+		wantURL    string
+	}{
+		{GitHub, "alice/blog", server.URL + "/alice/blog/pull/1"},
+		{Gitea, "alice/blog", server.URL + "/alice/blog/pulls/2"},
+		{GitLab, "alice/sites/blog", server.URL + "/alice/sites/blog/-/merge_requests/3"},
+	}
+	pr := PullRequest{Title: "Add note: hello", Body: "From Micropub", Head: "micropub/hello", Base: "main"}
+
+	for i, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			client, err := New(tt.kind, server.URL, tt.repository, "secret")
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			got, err := client.CreatePullRequest(context.Background(), pr)
+			if err != nil {
+				t.Fatalf("CreatePullRequest() error = %v", err)
+			}
+			if got != tt.wantURL {
+				t.Errorf("CreatePullRequest() = %q, want %q", got, tt.wantURL)
+			}
+
+			requests := server.Requests()
+			if len(requests) != i+1 {
+				t.Fatalf("Forge received %d pull requests, want %d", len(requests), i+1)
+			}
+			want := forgetest.Request{Forge: tt.kind, Repository: tt.repository, Token: "secret", Title: pr.Title, Body: pr.Body, Head: pr.Head, Base: pr.Base}
+			if requests[i] != want {
+				t.Errorf("Forge received %+v, want %+v", requests[i], want)
+			}
+		})
+	}
+}
+
+func TestCreatePullRequestError(t *testing.T) {
+	server := forgetest.NewServer()
+	defer server.Close()
+	server.Fail("A pull request already exists for alice:micropub/hello.")
+
+	client, err := New(GitHub, server.URL, "alice/blog", "secret")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	_, err = client.CreatePullRequest(context.Background(), PullRequest{Head: "micropub/hello", Base: "main"})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("CreatePullRequest() error = %v, want the message of the forge", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("bitbucket", "", "alice/blog", ""); err == nil {
+		t.Errorf("New() accepted an unsupported forge")
+	}
+	if _, err := New(Gitea, "", "alice/blog", ""); err == nil {
+		t.Errorf("New() accepted Gitea without a URL")
+	}
+	if _, err := New(GitHub, "", "", ""); err == nil {
+		t.Errorf("New() accepted a missing repository")
+	}
+}
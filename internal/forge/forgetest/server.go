@@ -0,0 +1,153 @@
+// Package forgetest provides a fake forge for tests, which records the pull
+// requests opened through the GitHub, Gitea and GitLab APIs.
+package forgetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Request is a pull request opened on the fake forge.
+type Request struct {
+	// Forge is the API the request was made with: "github", "gitea" or
+	// "gitlab".
+	Forge      string
+	Repository string
+	Token      string
+	Title      string
+	Body       string
+	Head       string
+	Base       string
+}
+
+// Server is a fake forge.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []Request
+	err      string
+}
+
+// NewServer starts a fake forge, which the caller should Close.
+func NewServer() *Server {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /repos/{owner}/{name}/pulls", s.handleGitHub)
+	mux.HandleFunc("POST /api/v1/repos/{owner}/{name}/pulls", s.handleGitea)
+	mux.HandleFunc("POST /api/v4/projects/{project}/merge_requests", s.handleGitLab)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Requests returns the pull requests opened so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Fail makes the forge refuse pull requests with message, or accept them
+// again when message is empty.
+func (s *Server) Fail(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = message
+}
+
+func (s *Server) handleGitHub(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Title, Body, Head, Base string
+	}
+	if !decode(w, r, &payload) {
+		return
+	}
+	repository := r.PathValue("owner") + "/" + r.PathValue("name")
+	s.record(w, "html_url", Request{
+		Forge:      "github",
+		Repository: repository,
+		Token:      strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "),
+		Title:      payload.Title,
+		Body:       payload.Body,
+		Head:       payload.Head,
+		Base:       payload.Base,
+	}, func(n int) string { return fmt.Sprintf("%s/%s/pull/%d", s.URL, repository, n) })
+}
+
+func (s *Server) handleGitea(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Title, Body, Head, Base string
+	}
+	if !decode(w, r, &payload) {
+		return
+	}
+	repository := r.PathValue("owner") + "/" + r.PathValue("name")
+	s.record(w, "html_url", Request{
+		Forge:      "gitea",
+		Repository: repository,
+		Token:      strings.TrimPrefix(r.Header.Get("Authorization"), "token "),
+		Title:      payload.Title,
+		Body:       payload.Body,
+		Head:       payload.Head,
+		Base:       payload.Base,
+	}, func(n int) string { return fmt.Sprintf("%s/%s/pulls/%d", s.URL, repository, n) })
+}
+
+func (s *Server) handleGitLab(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Title        string `json:"title"`
+		Description  string `json:"description"`
+		SourceBranch string `json:"source_branch"`
+		TargetBranch string `json:"target_branch"`
+	}
+	if !decode(w, r, &payload) {
+		return
+	}
+	project := r.PathValue("project")
+	s.record(w, "web_url", Request{
+		Forge:      "gitlab",
+		Repository: project,
+		Token:      r.Header.Get("PRIVATE-TOKEN"),
+		Title:      payload.Title,
+		Body:       payload.Description,
+		Head:       payload.SourceBranch,
+		Base:       payload.TargetBranch,
+	}, func(n int) string { return fmt.Sprintf("%s/%s/-/merge_requests/%d", s.URL, project, n) })
+}
+
+// decode reads the JSON body of r into payload, answering with an error when
+// it cannot.
+func decode(w http.ResponseWriter, r *http.Request, payload interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return false
+	}
+	return true
+}
+
+// record records req and answers with the URL of the pull request, built by
+// webURL from its number, under key.
+func (s *Server) record(w http.ResponseWriter, key string, req Request, webURL func(n int) string) {
+	s.mu.Lock()
+	if s.err != "" {
+		message := s.err
+		s.mu.Unlock()
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": message})
+		return
+	}
+	s.requests = append(s.requests, req)
+	n := len(s.requests)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, map[string]string{key: webURL(n)})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,34 @@
+package forge
+
+import (
+	"context"
+	"net/http"
+)
+
+// GiteaClient opens pull requests through the Gitea API, which Forgejo
+// shares.
+type GiteaClient struct {
+	api apiClient
+	// Repository is the repository, as "owner/name".
+	Repository string
+}
+
+// CreatePullRequest opens pr and returns its web URL.
+func (c *GiteaClient) CreatePullRequest(ctx context.Context, pr PullRequest) (string, error) {
+	payload := map[string]string{
+		"title": pr.Title,
+		"body":  pr.Body,
+		"head":  pr.Head,
+		"base":  pr.Base,
+	}
+	var result struct {
+		HTMLURL string `json:"html_url"`
+	}
+	auth := func(req *http.Request) {
+		req.Header.Set("Authorization", "token "+c.api.token)
+	}
+	if err := c.api.post(ctx, "/api/v1/repos/"+c.Repository+"/pulls", auth, payload, &result); err != nil {
+		return "", err
+	}
+	return result.HTMLURL, nil
+}
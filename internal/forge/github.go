@@ -0,0 +1,34 @@
+package forge
+
+import (
+	"context"
+	"net/http"
+)
+
+// GitHubClient opens pull requests through the GitHub REST API.
+type GitHubClient struct {
+	api apiClient
+	// Repository is the repository, as "owner/name".
+	Repository string
+}
+
+// CreatePullRequest opens pr and returns its web URL.
+func (c *GitHubClient) CreatePullRequest(ctx context.Context, pr PullRequest) (string, error) {
+	payload := map[string]string{
+		"title": pr.Title,
+		"body":  pr.Body,
+		"head":  pr.Head,
+		"base":  pr.Base,
+	}
+	var result struct {
+		HTMLURL string `json:"html_url"`
+	}
+	auth := func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+c.api.token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+	}
+	if err := c.api.post(ctx, "/repos/"+c.Repository+"/pulls", auth, payload, &result); err != nil {
+		return "", err
+	}
+	return result.HTMLURL, nil
+}
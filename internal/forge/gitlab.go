@@ -0,0 +1,34 @@
+package forge
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// GitLabClient opens merge requests through the GitLab REST API.
+type GitLabClient struct {
+	api apiClient
+	// Project is the path of the project, e.g. "group/name", or its ID.
+	Project string
+}
+
+// CreatePullRequest opens pr as a merge request and returns its web URL.
+func (c *GitLabClient) CreatePullRequest(ctx context.Context, pr PullRequest) (string, error) {
+	payload := map[string]string{
+		"title":         pr.Title,
+		"description":   pr.Body,
+		"source_branch": pr.Head,
+		"target_branch": pr.Base,
+	}
+	var result struct {
+		WebURL string `json:"web_url"`
+	}
+	auth := func(req *http.Request) {
+		req.Header.Set("PRIVATE-TOKEN", c.api.token)
+	}
+	if err := c.api.post(ctx, "/api/v4/projects/"+url.PathEscape(c.Project)+"/merge_requests", auth, payload, &result); err != nil {
+		return "", err
+	}
+	return result.WebURL, nil
+}
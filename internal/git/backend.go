@@ -0,0 +1,545 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Backend runs the Git commands behind DefaultGitOperations in RepoPath.
+type Backend interface {
+	// Init creates the repository, leaving an existing one alone.
+	Init() error
+	// Add stages the given paths, relative to RepoPath, including deletions.
+	Add(paths ...string) error
+	// Commit commits the staged changes, failing when there are none. Zero
+	// signatures are taken from the Git configuration.
+	Commit(message string, author, committer Signature) error
+	// Push pushes the current branch to its remote.
+	Push() error
+	// Sync fetches the current branch from the origin remote and resets the
+	// branch, the index and the tracked files of the working tree to it,
+	// dropping local commits. Untracked files are left alone.
+	Sync() error
+	// Head returns the hash of the commit checked out, or "" when there are
+	// no commits yet.
+	Head() (string, error)
+	// Reset moves the current branch back to commit and restores the index
+	// and the tracked files of the working tree to it. Untracked files are
+	// left alone. An empty commit empties the index.
+	Reset(commit string) error
+	// Branch returns the name of the current branch.
+	Branch() (string, error)
+	// Checkout switches to branch, creating it at HEAD, or resetting it to
+	// HEAD, when create is set. Tracked files follow the branch; untracked
+	// files are left alone.
+	Checkout(branch string, create bool) error
+	// DeleteBranch deletes a local branch.
+	DeleteBranch(branch string) error
+	// PushBranch pushes the local branch to the branch called remote on the
+	// origin remote.
+	PushBranch(local, remote string) error
+}
+
+// Names of the available backends.
+const (
+	BackendCLI   = "cli"
+	BackendGoGit = "go-git"
+)
+
+// Repo is the backend used by DefaultGitOperations.
+var Repo Backend = CLIBackend{}
+
+// NewBackend returns the backend called name. An empty name selects the
+// git command line.
+func NewBackend(name string) (Backend, error) {
+	switch strings.ToLower(name) {
+	case "", BackendCLI:
+		return CLIBackend{}, nil
+	case BackendGoGit:
+		return GoGitBackend{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported git backend %q, expected %q or %q", name, BackendCLI, BackendGoGit)
+	}
+}
+
+// CLIBackend runs the git binary, which must be installed.
+type CLIBackend struct{}
+
+func (CLIBackend) Init() error {
+	return runGit(nil, "init")
+}
+
+func (CLIBackend) Add(paths ...string) error {
+	return runGit(nil, append([]string{"add", "--all", "--"}, paths...)...)
+}
+
+func (CLIBackend) Commit(message string, author, committer Signature) error {
+	args := []string{"commit", "-m", message}
+	if !author.IsZero() {
+		args = append(args, "--author="+author.String())
+	}
+	var env []string
+	if !committer.IsZero() {
+		env = []string{"GIT_COMMITTER_NAME=" + committer.Name, "GIT_COMMITTER_EMAIL=" + committer.Email}
+	}
+	return runGit(env, args...)
+}
+
+func (CLIBackend) Push() error {
+	return runGit(nil, "push")
+}
+
+func (b CLIBackend) Sync() error {
+	branch, err := b.Branch()
+	if err != nil {
+		return err
+	}
+	if err := runGit(nil, "fetch", "--quiet", "origin", "refs/heads/"+branch+":refs/remotes/origin/"+branch); err != nil {
+		return err
+	}
+	return b.Reset("refs/remotes/origin/" + branch)
+}
+
+func (CLIBackend) Head() (string, error) {
+	out, err := outputGit("rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		// rev-parse --verify exits with 1 when HEAD does not point to a commit
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (CLIBackend) Reset(commit string) error {
+	if commit == "" {
+		return runGit(nil, "read-tree", "--empty")
+	}
+	// Unstage new files first, so that the hard reset leaves them alone
+	if err := runGit(nil, "reset", "--quiet", "--mixed", commit); err != nil {
+		return err
+	}
+	return runGit(nil, "reset", "--quiet", "--hard", commit)
+}
+
+func (CLIBackend) Branch() (string, error) {
+	out, err := outputGit("symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (CLIBackend) Checkout(branch string, create bool) error {
+	if create {
+		return runGit(nil, "checkout", "--quiet", "-B", branch)
+	}
+	return runGit(nil, "checkout", "--quiet", branch)
+}
+
+func (CLIBackend) DeleteBranch(branch string) error {
+	return runGit(nil, "branch", "--quiet", "-D", branch)
+}
+
+func (CLIBackend) PushBranch(local, remote string) error {
+	return runGit(nil, "push", "origin", "refs/heads/"+local+":refs/heads/"+remote)
+}
+
+// runGit runs git in RepoPath with env added to the environment. Errors
+// include what git printed.
+func runGit(env []string, args ...string) error {
+	var output bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = RepoPath
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(output.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// outputGit runs git in RepoPath and returns what it printed. Errors include
+// what git printed to stderr.
+func outputGit(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = RepoPath
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+// GoGitBackend works on the repository in-process with go-git, so the git
+// binary is not needed. Signatures that are not set are read from the Git
+// configuration. Pushing over SSH uses the SSH agent.
+type GoGitBackend struct{}
+
+func (GoGitBackend) Init() error {
+	_, err := gogit.PlainInit(RepoPath, false)
+	if errors.Is(err, gogit.ErrRepositoryAlreadyExists) {
+		return nil
+	}
+	return err
+}
+
+func (b GoGitBackend) Add(paths ...string) error {
+	worktree, err := b.worktree()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		// Deleted files are removed from the index, as with git add --all
+		if _, err := worktree.Add(filepath.ToSlash(path)); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func (GoGitBackend) Commit(message string, author, committer Signature) error {
+	repo, err := gogit.PlainOpen(RepoPath)
+	if err != nil {
+		return err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	// Refuse empty commits, as git commit does
+	status, err := worktree.Status()
+	if err != nil {
+		return err
+	}
+	staged := false
+	for _, file := range status {
+		if file.Staging != gogit.Unmodified && file.Staging != gogit.Untracked {
+			staged = true
+			break
+		}
+	}
+	if !staged {
+		return errors.New("nothing to commit")
+	}
+
+	options := &gogit.CommitOptions{}
+	if !author.IsZero() || !committer.IsZero() {
+		// Fill in the signatures that are not set from the configuration,
+		// as git does
+		configured, err := configSignature(repo)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		options.Author = goGitSignature(author, configured, now)
+		options.Committer = goGitSignature(committer, configured, now)
+	}
+
+	_, err = worktree.Commit(message, options)
+	return err
+}
+
+// configSignature returns the user configured for the repository, falling
+// back to the global configuration.
+func configSignature(repo *gogit.Repository) (Signature, error) {
+	cfg, err := repo.ConfigScoped(config.GlobalScope)
+	if err != nil {
+		return Signature{}, err
+	}
+	return Signature{Name: cfg.User.Name, Email: cfg.User.Email}, nil
+}
+
+func goGitSignature(signature, fallback Signature, when time.Time) *object.Signature {
+	if signature.IsZero() {
+		signature = fallback
+	}
+	return &object.Signature{Name: signature.Name, Email: signature.Email, When: when}
+}
+
+func (GoGitBackend) Push() error {
+	repo, err := gogit.PlainOpen(RepoPath)
+	if err != nil {
+		return err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	// Push only the current branch, as git push does by default
+	branch := head.Name().String()
+	err = repo.Push(&gogit.PushOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec(branch + ":" + branch)},
+	})
+	if errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	return err
+}
+
+func (GoGitBackend) Sync() error {
+	repo, err := gogit.PlainOpen(RepoPath)
+	if err != nil {
+		return err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	if !head.Name().IsBranch() {
+		return errors.New("HEAD is detached")
+	}
+
+	branch := head.Name().Short()
+	remoteName := plumbing.NewRemoteReferenceName("origin", branch)
+	err = repo.Fetch(&gogit.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{config.RefSpec("+" + head.Name().String() + ":" + remoteName.String())},
+	})
+	if err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return err
+	}
+	fetched, err := repo.Reference(remoteName, true)
+	if err != nil {
+		return err
+	}
+	if fetched.Hash() == head.Hash() {
+		return nil
+	}
+	return moveWorktree(repo, head.Hash(), fetched.Hash())
+}
+
+func (GoGitBackend) Head() (string, error) {
+	repo, err := gogit.PlainOpen(RepoPath)
+	if err != nil {
+		return "", err
+	}
+	head, err := repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return head.Hash().String(), nil
+}
+
+func (GoGitBackend) Reset(commit string) error {
+	repo, err := gogit.PlainOpen(RepoPath)
+	if err != nil {
+		return err
+	}
+	if commit == "" {
+		return repo.Storer.SetIndex(&index.Index{Version: 2})
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	// A hard reset in go-git also deletes untracked files, so reset the
+	// index and restore the tracked files that changed by hand
+	hash := plumbing.NewHash(commit)
+	if err := worktree.Reset(&gogit.ResetOptions{Commit: hash, Mode: gogit.MixedReset}); err != nil {
+		return err
+	}
+	tree, err := readTree(repo, hash)
+	if err != nil {
+		return err
+	}
+	return restoreWorktree(worktree, tree)
+}
+
+// readTree returns the tree of the commit with the given hash.
+func readTree(repo *gogit.Repository, hash plumbing.Hash) (*object.Tree, error) {
+	c, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	return c.Tree()
+}
+
+// restoreWorktree writes the tracked files that were modified or deleted in
+// the working tree back from tree, which the index must match.
+func restoreWorktree(worktree *gogit.Worktree, tree *object.Tree) error {
+	status, err := worktree.Status()
+	if err != nil {
+		return err
+	}
+	for name, file := range status {
+		if file.Worktree != gogit.Modified && file.Worktree != gogit.Deleted {
+			continue
+		}
+		if err := restoreFile(tree, name); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// restoreFile writes the file called name in tree to the working tree.
+func restoreFile(tree *object.Tree, name string) error {
+	file, err := tree.File(name)
+	if err != nil {
+		return err
+	}
+	mode, err := file.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+	reader, err := file.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	path := filepath.Join(RepoPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (GoGitBackend) Branch() (string, error) {
+	repo, err := gogit.PlainOpen(RepoPath)
+	if err != nil {
+		return "", err
+	}
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	}
+	if head.Type() != plumbing.SymbolicReference {
+		return "", errors.New("HEAD is detached")
+	}
+	return head.Target().Short(), nil
+}
+
+func (GoGitBackend) Checkout(branch string, create bool) error {
+	repo, err := gogit.PlainOpen(RepoPath)
+	if err != nil {
+		return err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	name := plumbing.NewBranchReferenceName(branch)
+	if create {
+		// The new branch is at HEAD, so the working tree stays as it is
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(name, head.Hash())); err != nil {
+			return err
+		}
+		return repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, name))
+	}
+
+	target, err := repo.Reference(name, true)
+	if err != nil {
+		return err
+	}
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, name)); err != nil {
+		return err
+	}
+	if target.Hash() == head.Hash() {
+		return nil
+	}
+	return moveWorktree(repo, head.Hash(), target.Hash())
+}
+
+// moveWorktree moves the current branch, the index and the tracked files of
+// the working tree from the commit fromHash to the commit toHash. go-git checkouts
+// and hard resets delete untracked files, so the index is switched and the
+// tracked files are updated by hand, as in Reset.
+func moveWorktree(repo *gogit.Repository, fromHash, toHash plumbing.Hash) error {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := worktree.Reset(&gogit.ResetOptions{Commit: toHash, Mode: gogit.MixedReset}); err != nil {
+		return err
+	}
+	from, err := readTree(repo, fromHash)
+	if err != nil {
+		return err
+	}
+	to, err := readTree(repo, toHash)
+	if err != nil {
+		return err
+	}
+	if err := restoreWorktree(worktree, to); err != nil {
+		return err
+	}
+
+	// Remove the files that are only tracked in the commit left
+	return from.Files().ForEach(func(file *object.File) error {
+		if _, err := to.File(file.Name); !errors.Is(err, object.ErrFileNotFound) {
+			return err
+		}
+		return removeCreated(filepath.FromSlash(file.Name))
+	})
+}
+
+func (GoGitBackend) DeleteBranch(branch string) error {
+	repo, err := gogit.PlainOpen(RepoPath)
+	if err != nil {
+		return err
+	}
+	return repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(branch))
+}
+
+func (GoGitBackend) PushBranch(local, remote string) error {
+	repo, err := gogit.PlainOpen(RepoPath)
+	if err != nil {
+		return err
+	}
+	refSpec := config.RefSpec(plumbing.NewBranchReferenceName(local).String() + ":" + plumbing.NewBranchReferenceName(remote).String())
+	err = repo.Push(&gogit.PushOptions{RefSpecs: []config.RefSpec{refSpec}})
+	if errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	return err
+}
+
+func (GoGitBackend) worktree() (*gogit.Worktree, error) {
+	repo, err := gogit.PlainOpen(RepoPath)
+	if err != nil {
+		return nil, err
+	}
+	return repo.Worktree()
+}
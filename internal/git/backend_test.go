@@ -0,0 +1,211 @@
+package git
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestBackends(t *testing.T) {
+	backends := []struct {
+		name    string
+		backend Backend
+	}{
+		{BackendCLI, CLIBackend{}},
+		{BackendGoGit, GoGitBackend{}},
+	}
+
+	for _, tt := range backends {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == BackendCLI {
+				if _, err := exec.LookPath("git"); err != nil {
+					t.Skip("git is not installed")
+				}
+			}
+			testBackend(t, tt.backend)
+		})
+	}
+}
+
+// testBackend creates, deletes and restores a post in a new repository pushing
+// to a temporary bare repository, and checks what was pushed.
+func testBackend(t *testing.T, backend Backend) {
+	repo, remote := newTestRepo(t, backend)
+
+	if err := InitializeRepo(); err != nil {
+		t.Fatalf("InitializeRepo() on an existing repository error = %v", err)
+	}
+
+	ops := &DefaultGitOperations{}
+	content := map[string]interface{}{
+		"type": []interface{}{"h-entry"},
+		"properties": map[string]interface{}{
+			"content":   []interface{}{"Hello"},
+			"mp-slug":   []interface{}{"hello"},
+			"published": []interface{}{"2024-03-05T10:00:00Z"},
+		},
+	}
+	if err := ops.CreatePost(content); err != nil {
+		t.Fatalf("CreatePost() error = %v", err)
+	}
+	if err := ops.DeletePost(map[string]interface{}{"url": content["url"]}); err != nil {
+		t.Fatalf("DeletePost() error = %v", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("Failed to read HEAD: %v", err)
+	}
+	pushed, err := remote.Reference(head.Name(), true)
+	if err != nil {
+		t.Fatalf("Branch %s was not pushed: %v", head.Name(), err)
+	}
+	if pushed.Hash() != head.Hash() {
+		t.Errorf("Remote is at %s, want %s", pushed.Hash(), head.Hash())
+	}
+
+	var messages []string
+	commits, err := remote.Log(&gogit.LogOptions{From: pushed.Hash()})
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	err = commits.ForEach(func(c *object.Commit) error {
+		messages = append(messages, c.Message)
+		if c.Author.Email != "author@example.com" {
+			t.Errorf("Commit author = %s, want author@example.com", c.Author.Email)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	want := []string{"Delete post: 2024-03-05-hello.md", "Add note: 2024-03-05-hello.md"}
+	if len(messages) != len(want) {
+		t.Fatalf("Commits = %q, want %q", messages, want)
+	}
+	for i := range want {
+		// git adds a trailing newline to messages
+		if messages[i] != want[i] && messages[i] != want[i]+"\n" {
+			t.Errorf("Commit %d = %q, want %q", i, messages[i], want[i])
+		}
+	}
+
+	tree := commitTree(t, remote, pushed.Hash())
+	if _, err := tree.File("2024-03-05-hello.md"); err == nil {
+		t.Errorf("Deleted post is still in the tree")
+	}
+	if _, err := tree.File(".trash/2024-03-05-hello.md"); err != nil {
+		t.Errorf("Deleted post is not in the trash: %v", err)
+	}
+
+	// A commit without changes fails
+	if err := Repo.Commit("Nothing", Signature{}, Signature{}); err == nil {
+		t.Errorf("Commit() without changes succeeded")
+	}
+
+	// Configured signatures and templates are used, with the user as author
+	originalAuthor, originalCommitter, originalAttribution, originalMessages := CommitAuthor, CommitCommitter, CommitAttribution, CommitMessages
+	defer func() {
+		CommitAuthor, CommitCommitter, CommitAttribution, CommitMessages = originalAuthor, originalCommitter, originalAttribution, originalMessages
+	}()
+	CommitAuthor = Signature{Name: "Site", Email: "site@example.com"}
+	CommitCommitter = Signature{Name: "Micropub", Email: "bot@example.com"}
+	CommitAttribution = AttributeMe
+	if CommitMessages, err = ParseCommitMessages(map[string]string{ActionUndelete: "Restore {{.Slug}} for {{.Client}}"}); err != nil {
+		t.Fatalf("ParseCommitMessages() error = %v", err)
+	}
+
+	undelete := map[string]interface{}{
+		"url":       content["url"],
+		"me":        "https://example.com/",
+		"client_id": "https://quill.p3k.io/",
+	}
+	if err := ops.UndeletePost(undelete); err != nil {
+		t.Fatalf("UndeletePost() error = %v", err)
+	}
+
+	head, err = repo.Head()
+	if err != nil {
+		t.Fatalf("Failed to read HEAD: %v", err)
+	}
+	commit, err := remote.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("Undelete commit was not pushed: %v", err)
+	}
+	if got, want := strings.TrimSpace(commit.Message), "Restore 2024-03-05-hello for quill.p3k.io"; got != want {
+		t.Errorf("Commit message = %q, want %q", got, want)
+	}
+	if commit.Author.Name != "https://example.com/" || commit.Author.Email != "site@example.com" {
+		t.Errorf("Commit author = %s <%s>, want https://example.com/ <site@example.com>", commit.Author.Name, commit.Author.Email)
+	}
+	if commit.Committer.Name != "Micropub" || commit.Committer.Email != "bot@example.com" {
+		t.Errorf("Commit committer = %s <%s>, want Micropub <bot@example.com>", commit.Committer.Name, commit.Committer.Email)
+	}
+}
+
+// newTestRepo initializes a repository in a temporary RepoPath, driven by
+// backend, that pushes to a temporary bare repository. RepoPath, Repo and
+// Layouts are restored when the test ends.
+func newTestRepo(t *testing.T, backend Backend) (repo, remote *gogit.Repository) {
+	t.Helper()
+	originalRepoPath, originalRepo, originalLayouts := RepoPath, Repo, Layouts
+	t.Cleanup(func() { RepoPath, Repo, Layouts = originalRepoPath, originalRepo, originalLayouts })
+	RepoPath, Repo, Layouts = t.TempDir(), backend, nil
+
+	remotePath := t.TempDir()
+	remote, err := gogit.PlainInit(remotePath, true)
+	if err != nil {
+		t.Fatalf("Failed to create remote: %v", err)
+	}
+
+	if err := InitializeRepo(); err != nil {
+		t.Fatalf("InitializeRepo() error = %v", err)
+	}
+
+	repo, err = gogit.PlainOpen(RepoPath)
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	cfg.User.Name = "Test Author"
+	cfg.User.Email = "author@example.com"
+	cfg.Raw.Section("push").SetOption("default", "current")
+	cfg.Raw.Section("commit").SetOption("gpgsign", "false")
+	cfg.Remotes["origin"] = &config.RemoteConfig{Name: "origin", URLs: []string{remotePath}}
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return repo, remote
+}
+
+func commitTree(t *testing.T, repo *gogit.Repository, hash plumbing.Hash) *object.Tree {
+	t.Helper()
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		t.Fatalf("Failed to read commit: %v", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		t.Fatalf("Failed to read tree: %v", err)
+	}
+	return tree
+}
+
+func TestNewBackend(t *testing.T) {
+	for _, name := range []string{"", "cli", "go-git"} {
+		if _, err := NewBackend(name); err != nil {
+			t.Errorf("NewBackend(%q) error = %v", name, err)
+		}
+	}
+	if _, err := NewBackend("libgit2"); err == nil {
+		t.Errorf("NewBackend(%q) expected error", "libgit2")
+	}
+}
@@ -0,0 +1,241 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Signature identifies the author or committer of a commit. A zero Signature
+// leaves the choice to the Git configuration of the repository.
+type Signature struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// IsZero reports whether the signature is unset.
+func (s Signature) IsZero() bool {
+	return s.Name == "" && s.Email == ""
+}
+
+// String formats the signature as "Name <email>".
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+}
+
+// Commit actions, used to pick the message template of a commit.
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionDelete    = "delete"
+	ActionUndelete  = "undelete"
+	ActionPublish   = "publish"
+	ActionUnpublish = "unpublish"
+)
+
+// Attribution modes for CommitAttribution.
+const (
+	AttributeMe     = "me"
+	AttributeClient = "client"
+)
+
+// CommitAuthor and CommitCommitter, when set, are the author and committer of
+// every commit.
+var (
+	CommitAuthor    Signature
+	CommitCommitter Signature
+)
+
+// CommitAttribution, when set to AttributeMe or AttributeClient, makes the
+// authenticated user or the Micropub client the author of the commits made
+// on their behalf, keeping the email of CommitAuthor.
+var CommitAttribution string
+
+// ParseAttribution validates an attribution mode. An empty mode disables
+// attribution.
+func ParseAttribution(mode string) (string, error) {
+	switch mode {
+	case "", AttributeMe, AttributeClient:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported commit attribution %q, expected %q or %q", mode, AttributeMe, AttributeClient)
+	}
+}
+
+// DefaultCommitMessages holds the message templates of the commits made for
+// each action.
+var DefaultCommitMessages = map[string]string{
+	ActionCreate:    "Add {{.Type}}: {{or .Title .Path}}",
+	ActionUpdate:    "Update post: {{.Path}}",
+	ActionDelete:    "Delete post: {{.Path}}",
+	ActionUndelete:  "Undelete post: {{.Path}}",
+	ActionPublish:   "Publish post: {{.Path}}",
+	ActionUnpublish: "Unpublish post: {{.Path}}",
+}
+
+// CommitMessages holds the parsed message templates by action. Actions
+// without a template use DefaultCommitMessages.
+var CommitMessages map[string]*template.Template
+
+// sampleCommitData is the data message templates are tried with when they
+// are parsed.
+var sampleCommitData = CommitData{
+	Type:     "note",
+	Title:    "Hello World",
+	Slug:     "2024-03-05-hello-world",
+	Path:     "2024-03-05-hello-world.md",
+	URL:      "/2024-03-05-hello-world.md",
+	Me:       "https://example.com/",
+	ClientID: "https://quill.p3k.io/",
+	Client:   "quill.p3k.io",
+}
+
+// ParseCommitMessages parses message templates by action, as configured.
+// Each template is rendered with sample data, so that templates that would
+// fail every commit, such as those using unknown fields, are rejected here.
+func ParseCommitMessages(messages map[string]string) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template, len(messages))
+	for action, text := range messages {
+		if _, ok := DefaultCommitMessages[action]; !ok {
+			return nil, fmt.Errorf("unknown commit action %q", action)
+		}
+		tmpl, err := template.New(action).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s commit message: %v", action, err)
+		}
+
+		data := sampleCommitData
+		data.Action = action
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("invalid %s commit message: %v", action, err)
+		}
+		if strings.TrimSpace(buf.String()) == "" {
+			return nil, fmt.Errorf("invalid %s commit message: it is empty", action)
+		}
+		templates[action] = tmpl
+	}
+	return templates, nil
+}
+
+// CommitData is available to commit message templates.
+type CommitData struct {
+	// Action is the action the commit is made for, e.g. "create".
+	Action string
+	// Type is the post type, e.g. "note".
+	Type string
+	// Title is the name of the post, if it has one.
+	Title string
+	// Slug is the slug of the post, taken from its path.
+	Slug string
+	// Path is the path of the post in the repository.
+	Path string
+	// URL is the path of the public URL of the post.
+	URL string
+	// Me is the URL of the authenticated user, if any.
+	Me string
+	// ClientID is the client ID of the Micropub client, if any.
+	ClientID string
+	// Client is the name of the Micropub client, taken from its client ID.
+	Client string
+}
+
+// newCommitData returns the template data of a commit for the post stored at
+// filename. Details of the post are taken from its frontmatter, when read,
+// and from the request content.
+func newCommitData(action, filename string, frontmatter, content map[string]interface{}) CommitData {
+	postPath := filepath.ToSlash(filename)
+	data := CommitData{
+		Action: action,
+		Path:   postPath,
+		Slug:   pathSlug(postPath),
+		URL:    PublicPath(postPath),
+	}
+	data.Me, _ = content["me"].(string)
+	data.ClientID, _ = content["client_id"].(string)
+	data.Client = clientName(data.ClientID)
+
+	if properties, ok := content["properties"].(map[string]interface{}); ok {
+		data.Title = postTitle(properties)
+	}
+	data.Type, _ = content["post-type"].(string)
+	if title, ok := frontmatter[FrontmatterKey("name")].(string); ok && data.Title == "" {
+		data.Title = title
+	}
+	if postType, ok := frontmatter["post-type"].(string); ok && data.Type == "" {
+		data.Type = postType
+	}
+	return data
+}
+
+// pathSlug returns the slug of a post from its path: the file name without
+// extension, or the directory name for page bundles.
+func pathSlug(postPath string) string {
+	name := strings.TrimSuffix(path.Base(postPath), path.Ext(postPath))
+	if name == "index" || name == "_index" {
+		name = path.Base(path.Dir(postPath))
+	}
+	return name
+}
+
+// clientName returns a readable name for a client ID, its host.
+func clientName(clientID string) string {
+	if u, err := url.Parse(clientID); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return clientID
+}
+
+// commitMessage renders the message template of data.Action.
+func commitMessage(data CommitData) (string, error) {
+	tmpl, ok := CommitMessages[data.Action]
+	if !ok {
+		var err error
+		tmpl, err = template.New(data.Action).Parse(DefaultCommitMessages[data.Action])
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render commit message: %v", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// commitAuthor returns the author of a commit, attributing it to the user or
+// client when configured.
+func commitAuthor(data CommitData) Signature {
+	author := CommitAuthor
+	switch CommitAttribution {
+	case AttributeMe:
+		if data.Me != "" {
+			author.Name = data.Me
+		}
+	case AttributeClient:
+		if data.Client != "" {
+			author.Name = data.Client
+		}
+	}
+	return author
+}
+
+// commit commits the staged changes of a post with the configured message,
+// author and committer, and records the commit in the transaction.
+func (tx *Tx) commit(data CommitData) error {
+	message, err := commitMessage(data)
+	if err != nil {
+		return err
+	}
+	if err := gitCommit(message, commitAuthor(data), CommitCommitter); err != nil {
+		return err
+	}
+	tx.commits = append(tx.commits, data)
+	tx.messages = append(tx.messages, message)
+	return nil
+}
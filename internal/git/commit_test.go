@@ -0,0 +1,92 @@
+package git
+
+import "testing"
+
+func TestCommitMessage(t *testing.T) {
+	originalMessages := CommitMessages
+	defer func() { CommitMessages = originalMessages }()
+
+	content := map[string]interface{}{
+		"post-type": TypeArticle,
+		"properties": map[string]interface{}{
+			"name": []interface{}{"Hello World"},
+		},
+		"me":        "https://example.com/",
+		"client_id": "https://quill.p3k.io/",
+	}
+	data := newCommitData(ActionCreate, "content/posts/hello-world/index.md", nil, content)
+
+	CommitMessages = nil
+	if got, err := commitMessage(data); err != nil || got != "Add article: Hello World" {
+		t.Errorf("commitMessage() = %q, %v, want default message", got, err)
+	}
+
+	var err error
+	CommitMessages, err = ParseCommitMessages(map[string]string{
+		ActionCreate: "{{.Type}}({{.Slug}}): {{.Title}}\n\nPosted from {{.Client}} by {{.Me}}",
+	})
+	if err != nil {
+		t.Fatalf("ParseCommitMessages() error = %v", err)
+	}
+	want := "article(hello-world): Hello World\n\nPosted from quill.p3k.io by https://example.com/"
+	if got, err := commitMessage(data); err != nil || got != want {
+		t.Errorf("commitMessage() = %q, %v, want %q", got, err, want)
+	}
+
+	// Titles of existing posts come from their frontmatter
+	data = newCommitData(ActionUpdate, "note.md", map[string]interface{}{"title": "Old", "post-type": TypeNote}, map[string]interface{}{})
+	if data.Title != "Old" || data.Type != TypeNote || data.Client != "" {
+		t.Errorf("newCommitData() = %+v", data)
+	}
+}
+
+func TestParseCommitMessages(t *testing.T) {
+	if _, err := ParseCommitMessages(map[string]string{"launch": "Launch"}); err == nil {
+		t.Errorf("ParseCommitMessages() accepted an unknown action")
+	}
+	if _, err := ParseCommitMessages(map[string]string{ActionCreate: "{{.Type"}); err == nil {
+		t.Errorf("ParseCommitMessages() accepted an invalid template")
+	}
+	// Templates that would fail every commit are rejected up front
+	for _, text := range []string{"Add {{.Titel}}", "{{.Title.Name}}", "  "} {
+		if _, err := ParseCommitMessages(map[string]string{ActionCreate: text}); err == nil {
+			t.Errorf("ParseCommitMessages() accepted %q", text)
+		}
+	}
+	if _, err := ParseCommitMessages(map[string]string{ActionUpdate: "{{.Action}} {{or .Title .Slug}} via {{.Client}}"}); err != nil {
+		t.Errorf("ParseCommitMessages() error = %v", err)
+	}
+}
+
+func TestCommitAuthor(t *testing.T) {
+	originalAuthor, originalAttribution := CommitAuthor, CommitAttribution
+	defer func() { CommitAuthor, CommitAttribution = originalAuthor, originalAttribution }()
+	CommitAuthor = Signature{Name: "Site", Email: "site@example.com"}
+	data := CommitData{Me: "https://example.com/", Client: "quill.p3k.io"}
+
+	tests := []struct {
+		attribution string
+		want        Signature
+	}{
+		{"", Signature{Name: "Site", Email: "site@example.com"}},
+		{AttributeMe, Signature{Name: "https://example.com/", Email: "site@example.com"}},
+		{AttributeClient, Signature{Name: "quill.p3k.io", Email: "site@example.com"}},
+	}
+	for _, tt := range tests {
+		CommitAttribution = tt.attribution
+		if got := commitAuthor(data); got != tt.want {
+			t.Errorf("commitAuthor() with %q attribution = %v, want %v", tt.attribution, got, tt.want)
+		}
+	}
+}
+
+func TestParseAttribution(t *testing.T) {
+	for _, mode := range []string{"", AttributeMe, AttributeClient} {
+		if _, err := ParseAttribution(mode); err != nil {
+			t.Errorf("ParseAttribution(%q) error = %v", mode, err)
+		}
+	}
+	if _, err := ParseAttribution("author"); err == nil {
+		t.Errorf("ParseAttribution(%q) expected error", "author")
+	}
+}
@@ -0,0 +1,166 @@
+package git
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/harperreed/micropub-service/internal/config"
+)
+
+// Values of the post-status property.
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+)
+
+// DraftKey, when set, is the frontmatter key set to true on drafts instead of
+// the one of ActiveProfile.
+var DraftKey string
+
+// DraftLayout, when its path is set, is where drafts are written instead of
+// the draft layout of ActiveProfile.
+var DraftLayout config.Layout
+
+// draftKey returns the frontmatter key marking drafts. Drafts are marked with
+// "draft: true" unless they are kept in a draft layout.
+func draftKey() string {
+	if DraftKey != "" {
+		return DraftKey
+	}
+	if ActiveProfile.DraftKey != "" {
+		return ActiveProfile.DraftKey
+	}
+	if draftLayout().Path != "" {
+		return ""
+	}
+	return "draft"
+}
+
+// draftLayout returns the layout drafts are written with, if any.
+func draftLayout() config.Layout {
+	if DraftLayout.Path != "" {
+		return DraftLayout
+	}
+	return ActiveProfile.DraftLayout
+}
+
+// draftDir returns the directory, as a slash path, that the draft layout
+// writes to, or "" when drafts are not kept apart.
+func draftDir() string {
+	template := draftLayout().Path
+	if template == "" {
+		return ""
+	}
+	if i := strings.Index(template, "{"); i >= 0 {
+		template = template[:i]
+	}
+	if dir := path.Dir(template + "x"); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// IsDraft reports whether a new post is a draft, either through a post-status
+// of draft or an mp-draft command. An explicit post-status takes precedence.
+func IsDraft(properties map[string]interface{}) bool {
+	if status := propertyText(properties, "post-status"); status != "" {
+		return strings.EqualFold(status, StatusDraft)
+	}
+	if properties["mp-draft"] == nil {
+		return false
+	}
+	switch strings.ToLower(propertyText(properties, "mp-draft")) {
+	case "false", "0", "no", "off":
+		return false
+	}
+	return true
+}
+
+// isDraftPost reports whether the post stored at filename is a draft.
+func isDraftPost(filename string, frontmatter map[string]interface{}) bool {
+	if key := draftKey(); key != "" && frontmatter[key] == true {
+		return true
+	}
+	dir := draftDir()
+	return dir != "" && strings.HasPrefix(filepath.ToSlash(filename), dir+"/")
+}
+
+// RequestedStatus returns the post-status an update request sets, or "" when
+// the request leaves it alone. Removing the post-status publishes the post.
+func RequestedStatus(content map[string]interface{}) string {
+	for _, operation := range []string{"replace", "add"} {
+		properties, _ := content[operation].(map[string]interface{})
+		value, ok := properties["post-status"]
+		if !ok {
+			continue
+		}
+		if values := propertyValues(value); len(values) > 0 {
+			return strings.ToLower(contentText(values))
+		}
+		return StatusPublished
+	}
+
+	switch remove := content["delete"].(type) {
+	case []interface{}:
+		for _, name := range remove {
+			if name == "post-status" {
+				return StatusPublished
+			}
+		}
+	case map[string]interface{}:
+		if _, ok := remove["post-status"]; ok {
+			return StatusPublished
+		}
+	}
+	return ""
+}
+
+// setPostStatus marks the post stored at filename as a draft or as published
+// and returns the file the post belongs in, which changes when drafts are kept
+// in a draft layout.
+func setPostStatus(filename string, frontmatter map[string]interface{}, body string, draft bool) (string, error) {
+	if key := draftKey(); key != "" {
+		if draft {
+			frontmatter[key] = true
+		} else {
+			delete(frontmatter, key)
+		}
+	}
+
+	dir := draftDir()
+	if dir == "" || strings.HasPrefix(filepath.ToSlash(filename), dir+"/") == draft {
+		return filename, nil
+	}
+
+	// Plan the new location from the properties stored in the post
+	properties := make(map[string]interface{}, len(frontmatter)+1)
+	for key, value := range frontmatter {
+		properties[PropertyName(key)] = propertyValues(value)
+	}
+	properties["content"] = []interface{}{body}
+	if draft {
+		properties["post-status"] = []interface{}{StatusDraft}
+	}
+	content := map[string]interface{}{
+		"type":       []interface{}{"h-entry"},
+		"properties": properties,
+	}
+	if _, err := PlanPost(content); err != nil {
+		return "", fmt.Errorf("failed to plan post location: %v", err)
+	}
+	return filepath.FromSlash(content["path"].(string)), nil
+}
+
+// sourceStatus replaces the draft marker of a post read from the repository
+// with a post-status of draft.
+func sourceStatus(filename string, frontmatter map[string]interface{}) {
+	if !isDraftPost(filename, frontmatter) {
+		return
+	}
+	if key := draftKey(); key != "" {
+		delete(frontmatter, key)
+	}
+	frontmatter["post-status"] = StatusDraft
+}
@@ -0,0 +1,146 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIsDraft(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		want       bool
+	}{
+		{"None", map[string]interface{}{}, false},
+		{"PostStatusDraft", map[string]interface{}{"post-status": []interface{}{"draft"}}, true},
+		{"PostStatusPublished", map[string]interface{}{"post-status": []interface{}{"published"}}, false},
+		{"MPDraft", map[string]interface{}{"mp-draft": []interface{}{"true"}}, true},
+		{"MPDraftEmpty", map[string]interface{}{"mp-draft": []interface{}{""}}, true},
+		{"MPDraftFalse", map[string]interface{}{"mp-draft": []interface{}{"false"}}, false},
+		{"PostStatusWins", map[string]interface{}{"post-status": []interface{}{"published"}, "mp-draft": []interface{}{"true"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsDraft(tt.properties); got != tt.want {
+				t.Errorf("IsDraft() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDraftFrontmatter(t *testing.T) {
+	properties := map[string]interface{}{
+		"content":     []interface{}{"Not done yet"},
+		"post-status": []interface{}{"draft"},
+		"published":   []interface{}{"2024-03-05T10:00:00Z"},
+	}
+	want := map[string]interface{}{
+		"date":      "2024-03-05T10:00:00Z",
+		"draft":     true,
+		"post-type": TypeNote,
+	}
+
+	if got := postFrontmatter(properties, TypeNote); !reflect.DeepEqual(got, want) {
+		t.Errorf("postFrontmatter() = %#v, want %#v", got, want)
+	}
+}
+
+func TestRequestedStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		content map[string]interface{}
+		want    string
+	}{
+		{"Unchanged", map[string]interface{}{"replace": map[string]interface{}{"name": []interface{}{"Hi"}}}, ""},
+		{"Replace", map[string]interface{}{"replace": map[string]interface{}{"post-status": []interface{}{"published"}}}, StatusPublished},
+		{"Add", map[string]interface{}{"add": map[string]interface{}{"post-status": []interface{}{"Draft"}}}, StatusDraft},
+		{"ReplaceEmpty", map[string]interface{}{"replace": map[string]interface{}{"post-status": []interface{}{}}}, StatusPublished},
+		{"DeleteList", map[string]interface{}{"delete": []interface{}{"post-status"}}, StatusPublished},
+		{"DeleteValues", map[string]interface{}{"delete": map[string]interface{}{"post-status": []interface{}{"draft"}}}, StatusPublished},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequestedStatus(tt.content); got != tt.want {
+				t.Errorf("RequestedStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetPostStatus(t *testing.T) {
+	originalProfile := ActiveProfile
+	defer func() { ActiveProfile = originalProfile }()
+
+	t.Run("DraftKey", func(t *testing.T) {
+		ActiveProfile = Profiles["hugo"]
+		frontmatter := map[string]interface{}{"title": "Post", "draft": true}
+		filename := filepath.Join("content", "posts", "post.md")
+
+		newName, err := setPostStatus(filename, frontmatter, "Body", false)
+		if err != nil {
+			t.Fatalf("setPostStatus() error = %v", err)
+		}
+		if newName != filename {
+			t.Errorf("setPostStatus() moved the post to %q", newName)
+		}
+		if _, ok := frontmatter["draft"]; ok {
+			t.Errorf("setPostStatus() kept the draft key: %v", frontmatter)
+		}
+
+		if _, err := setPostStatus(filename, frontmatter, "Body", true); err != nil {
+			t.Fatalf("setPostStatus() error = %v", err)
+		}
+		if frontmatter["draft"] != true {
+			t.Errorf("setPostStatus() did not set the draft key: %v", frontmatter)
+		}
+	})
+
+	t.Run("DraftLayout", func(t *testing.T) {
+		ActiveProfile = Profiles["jekyll"]
+		frontmatter := map[string]interface{}{
+			"title": "Work in Progress",
+			"date":  "2024-03-05T10:00:00Z",
+		}
+		filename := filepath.Join("_drafts", "work-in-progress.md")
+		if !isDraftPost(filename, frontmatter) {
+			t.Fatalf("isDraftPost(%q) = false, want true", filename)
+		}
+
+		newName, err := setPostStatus(filename, frontmatter, "Body", false)
+		if err != nil {
+			t.Fatalf("setPostStatus() error = %v", err)
+		}
+		if want := filepath.Join("_posts", "2024-03-05-work-in-progress.md"); newName != want {
+			t.Errorf("setPostStatus() = %q, want %q", newName, want)
+		}
+
+		draftName, err := setPostStatus(newName, frontmatter, "Body", true)
+		if err != nil {
+			t.Fatalf("setPostStatus() error = %v", err)
+		}
+		if draftName != filename {
+			t.Errorf("setPostStatus() = %q, want %q", draftName, filename)
+		}
+	})
+}
+
+func TestReadPostDraft(t *testing.T) {
+	filename := filepath.Join(RepoPath, "2024-01-01-draft-post.md")
+	if err := os.WriteFile(filename, []byte("---\ndraft: true\ntitle: Draft\n---\n\nBody"), 0644); err != nil {
+		t.Fatalf("Failed to write post: %v", err)
+	}
+	defer os.Remove(filename)
+
+	frontmatter, _, err := ReadPost("/2024-01-01-draft-post.md")
+	if err != nil {
+		t.Fatalf("ReadPost() error = %v", err)
+	}
+	want := map[string]interface{}{"title": "Draft", "post-status": StatusDraft}
+	if !reflect.DeepEqual(frontmatter, want) {
+		t.Errorf("ReadPost() = %#v, want %#v", frontmatter, want)
+	}
+}
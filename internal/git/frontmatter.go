@@ -0,0 +1,258 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Format is a frontmatter format.
+type Format string
+
+// Supported frontmatter formats and the delimiters that identify them.
+const (
+	FormatYAML Format = "yaml" // delimited by ---
+	FormatTOML Format = "toml" // delimited by +++
+	FormatJSON Format = "json" // a JSON object at the start of the file
+)
+
+// FrontmatterFormat is the format new posts are written in. Existing posts
+// keep the format they were written in when updated.
+var FrontmatterFormat = FormatYAML
+
+// ParseFormat returns the Format named by s. An empty name selects YAML.
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case "", FormatYAML:
+		return FormatYAML, nil
+	case FormatTOML:
+		return FormatTOML, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported frontmatter format %q", s)
+	}
+}
+
+// MarshalFrontmatter renders frontmatter in format, followed by body. Keys are
+// written in sorted order so that the output is stable.
+func MarshalFrontmatter(format Format, frontmatter map[string]interface{}, body string) (string, error) {
+	var sb strings.Builder
+
+	switch format {
+	case FormatYAML, "":
+		// yaml.v2 sorts map keys
+		data, err := yaml.Marshal(frontmatter)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString("---\n")
+		sb.Write(data)
+		sb.WriteString("---\n")
+	case FormatTOML:
+		// The TOML encoder sorts map keys, writing tables after plain values
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(frontmatter); err != nil {
+			return "", err
+		}
+		sb.WriteString("+++\n")
+		sb.Write(buf.Bytes())
+		sb.WriteString("+++\n")
+	case FormatJSON:
+		// encoding/json sorts map keys
+		data, err := json.MarshalIndent(frontmatter, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		sb.Write(data)
+		sb.WriteString("\n")
+	default:
+		return "", fmt.Errorf("unsupported frontmatter format %q", format)
+	}
+
+	sb.WriteString(body)
+	return sb.String(), nil
+}
+
+// FrontmatterError reports malformed frontmatter.
+type FrontmatterError struct {
+	// Line is the line of the post the error was found on, starting at 1.
+	Line int
+	Msg  string
+}
+
+func (e *FrontmatterError) Error() string {
+	return fmt.Sprintf("invalid frontmatter on line %d: %s", e.Line, e.Msg)
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// ParseFrontmatter detects the format of the frontmatter at the start of
+// content and returns the decoded frontmatter, the body following the line
+// that closes the frontmatter, and the format.
+//
+// YAML and TOML frontmatter must be opened and closed by a line holding only
+// the delimiter, so the delimiters may appear anywhere else in the post. JSON
+// frontmatter is an object starting on the first line. Posts without
+// frontmatter have an empty frontmatter in FrontmatterFormat. Malformed
+// frontmatter is reported as a *FrontmatterError.
+func ParseFrontmatter(content string) (map[string]interface{}, string, Format, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	first, _ := nextLine(content, 0)
+
+	switch strings.TrimRight(first, " \t\r") {
+	case "---":
+		return parseDelimited(content, "---", FormatYAML)
+	case "+++":
+		return parseDelimited(content, "+++", FormatTOML)
+	}
+	if strings.HasPrefix(first, "{") {
+		return parseJSON(content)
+	}
+
+	return make(map[string]interface{}), content, FrontmatterFormat, nil
+}
+
+// nextLine returns the line starting at offset, without its line ending, and
+// the offset of the following line.
+func nextLine(content string, offset int) (string, int) {
+	end := strings.IndexByte(content[offset:], '\n')
+	if end < 0 {
+		return content[offset:], len(content)
+	}
+	return content[offset : offset+end], offset + end + 1
+}
+
+// parseDelimited decodes frontmatter enclosed by delimiter lines.
+func parseDelimited(content, delimiter string, format Format) (map[string]interface{}, string, Format, error) {
+	_, start := nextLine(content, 0)
+
+	for offset := start; offset < len(content); {
+		text, next := nextLine(content, offset)
+		if strings.TrimRight(text, " \t\r") != delimiter {
+			offset = next
+			continue
+		}
+
+		frontmatter, err := decodeFrontmatter(content[start:offset], format)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return frontmatter, content[next:], format, nil
+	}
+
+	return nil, "", "", &FrontmatterError{Line: 1, Msg: fmt.Sprintf("%s is not closed", delimiter)}
+}
+
+// decodeFrontmatter decodes a YAML or TOML block that starts on the second
+// line of the post, adjusting error line numbers to match the post.
+func decodeFrontmatter(block string, format Format) (map[string]interface{}, error) {
+	var frontmatter map[string]interface{}
+
+	switch format {
+	case FormatYAML:
+		if err := yaml.Unmarshal([]byte(block), &frontmatter); err != nil {
+			if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+				n, _ := strconv.Atoi(m[1])
+				return nil, &FrontmatterError{Line: n + 1, Msg: m[2]}
+			}
+			return nil, &FrontmatterError{Line: 1, Msg: err.Error()}
+		}
+	case FormatTOML:
+		if _, err := toml.Decode(block, &frontmatter); err != nil {
+			var perr toml.ParseError
+			if errors.As(err, &perr) {
+				msg := perr.Message
+				if msg == "" {
+					msg = perr.Error()
+				}
+				return nil, &FrontmatterError{Line: perr.Position.Line + 1, Msg: msg}
+			}
+			return nil, &FrontmatterError{Line: 1, Msg: err.Error()}
+		}
+	}
+
+	return normalizeFrontmatter(frontmatter), nil
+}
+
+// parseJSON decodes a JSON object at the start of the post. The object must
+// be followed by the end of its line.
+func parseJSON(content string) (map[string]interface{}, string, Format, error) {
+	var frontmatter map[string]interface{}
+
+	decoder := json.NewDecoder(strings.NewReader(content))
+	if err := decoder.Decode(&frontmatter); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, "", "", &FrontmatterError{Line: lineAt(content, int(syntaxErr.Offset)), Msg: syntaxErr.Error()}
+		}
+		return nil, "", "", &FrontmatterError{Line: 1, Msg: err.Error()}
+	}
+
+	offset := int(decoder.InputOffset())
+	rest, next := nextLine(content, offset)
+	if strings.TrimSpace(rest) != "" {
+		return nil, "", "", &FrontmatterError{Line: lineAt(content, offset), Msg: "unexpected text after JSON frontmatter"}
+	}
+
+	return normalizeFrontmatter(frontmatter), content[next:], FormatJSON, nil
+}
+
+// lineAt returns the line number of a byte offset in content.
+func lineAt(content string, offset int) int {
+	if offset > len(content) {
+		offset = len(content)
+	}
+	return strings.Count(content[:offset], "\n") + 1
+}
+
+// normalizeFrontmatter converts decoded values into the map[string]interface{}
+// and []interface{} types used for Micropub properties.
+func normalizeFrontmatter(frontmatter map[string]interface{}) map[string]interface{} {
+	if frontmatter == nil {
+		return make(map[string]interface{})
+	}
+	for key, value := range frontmatter {
+		frontmatter[key] = normalizeValue(value)
+	}
+	return frontmatter
+}
+
+// normalizeValue converts the map[interface{}]interface{} values produced by
+// the YAML decoder and the []map[string]interface{} arrays of tables produced
+// by the TOML decoder so they can be encoded in any format.
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprintf("%v", key)] = normalizeValue(item)
+		}
+		return m
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeValue(item)
+		}
+		return v
+	case []map[string]interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = normalizeValue(item)
+		}
+		return values
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeValue(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
@@ -0,0 +1,184 @@
+package git
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFrontmatterRoundTrip(t *testing.T) {
+	newFrontmatter := func() map[string]interface{} {
+		return map[string]interface{}{
+			"title":    "Colons: and \"quotes\" --- # not a comment",
+			"date":     "2024-03-05T10:00:00Z",
+			"summary":  "First line\nSecond line",
+			"tags":     []interface{}{"go", "indieweb"},
+			"draft":    false,
+			"location": map[string]interface{}{"name": "Chicago", "latitude": 41.88},
+			"photo": []interface{}{
+				map[string]interface{}{"value": "https://example.com/a.jpg", "alt": "A"},
+			},
+		}
+	}
+
+	tests := []struct {
+		format Format
+		prefix string
+	}{
+		{FormatYAML, "---\n"},
+		{FormatTOML, "+++\n"},
+		{FormatJSON, "{\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			data, err := MarshalFrontmatter(tt.format, newFrontmatter(), "\nThe body")
+			if err != nil {
+				t.Fatalf("MarshalFrontmatter() error = %v", err)
+			}
+			if !strings.HasPrefix(data, tt.prefix) {
+				t.Errorf("MarshalFrontmatter() = %q, want prefix %q", data, tt.prefix)
+			}
+
+			frontmatter, body, format, err := ParseFrontmatter(data)
+			if err != nil {
+				t.Fatalf("ParseFrontmatter() error = %v\n%s", err, data)
+			}
+			if format != tt.format {
+				t.Errorf("ParseFrontmatter() format = %q, want %q", format, tt.format)
+			}
+			if !reflect.DeepEqual(frontmatter, newFrontmatter()) {
+				t.Errorf("ParseFrontmatter() = %#v, want %#v", frontmatter, newFrontmatter())
+			}
+			if body != "\nThe body" {
+				t.Errorf("ParseFrontmatter() body = %q", body)
+			}
+
+			again, err := MarshalFrontmatter(format, frontmatter, body)
+			if err != nil {
+				t.Fatalf("MarshalFrontmatter() error = %v", err)
+			}
+			if again != data {
+				t.Errorf("round trip changed the post:\n%s\nwant:\n%s", again, data)
+			}
+		})
+	}
+}
+
+func TestParseFrontmatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]interface{}
+		body    string
+		format  Format
+	}{
+		{
+			name:    "rule in body",
+			content: "---\ntitle: Rules\n---\nAbove\n\n---\n\nBelow\n",
+			want:    map[string]interface{}{"title": "Rules"},
+			body:    "Above\n\n---\n\nBelow\n",
+			format:  FormatYAML,
+		},
+		{
+			name:    "delimiter in value",
+			content: "---\ntitle: a --- b\nsummary: |\n  ---indented\n---\nBody",
+			want:    map[string]interface{}{"title": "a --- b", "summary": "---indented\n"},
+			body:    "Body",
+			format:  FormatYAML,
+		},
+		{
+			name:    "crlf",
+			content: "+++\r\ntitle = \"Windows\"\r\n+++\r\nBody\r\n",
+			want:    map[string]interface{}{"title": "Windows"},
+			body:    "Body\r\n",
+			format:  FormatTOML,
+		},
+		{
+			name:    "byte order mark",
+			content: "\ufeff---\ntitle: BOM\n---\n",
+			want:    map[string]interface{}{"title": "BOM"},
+			body:    "",
+			format:  FormatYAML,
+		},
+		{
+			name:    "json",
+			content: "{\"title\": \"JSON\"}\n---\n",
+			want:    map[string]interface{}{"title": "JSON"},
+			body:    "---\n",
+			format:  FormatJSON,
+		},
+		{
+			name:    "none",
+			content: "Just text\n---\n",
+			want:    map[string]interface{}{},
+			body:    "Just text\n---\n",
+			format:  FrontmatterFormat,
+		},
+		{
+			name:    "not a delimiter line",
+			content: "--- not frontmatter\n",
+			want:    map[string]interface{}{},
+			body:    "--- not frontmatter\n",
+			format:  FrontmatterFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frontmatter, body, format, err := ParseFrontmatter(tt.content)
+			if err != nil {
+				t.Fatalf("ParseFrontmatter() error = %v", err)
+			}
+			if !reflect.DeepEqual(frontmatter, tt.want) {
+				t.Errorf("ParseFrontmatter() = %#v, want %#v", frontmatter, tt.want)
+			}
+			if body != tt.body {
+				t.Errorf("ParseFrontmatter() body = %q, want %q", body, tt.body)
+			}
+			if format != tt.format {
+				t.Errorf("ParseFrontmatter() format = %q, want %q", format, tt.format)
+			}
+		})
+	}
+}
+
+func TestParseFrontmatterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    int
+	}{
+		{"unclosed yaml", "---\ntitle: Open\n\nBody\n", 1},
+		{"unclosed toml", "+++\ntitle = \"Open\"\n", 1},
+		{"yaml syntax", "---\ntitle: Fine\ntags: [go\n---\n", 3},
+		{"toml syntax", "+++\ntitle = \"Fine\"\n\n= \"no key\"\n+++\n", 4},
+		{"json syntax", "{\n  \"title\": \"Fine\",\n  \"date\" 1\n}\n", 3},
+		{"json trailing text", "{\"title\": \"Fine\"} extra\n", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := ParseFrontmatter(tt.content)
+			var fmErr *FrontmatterError
+			if !errors.As(err, &fmErr) {
+				t.Fatalf("ParseFrontmatter() error = %v, want *FrontmatterError", err)
+			}
+			if fmErr.Line != tt.line {
+				t.Errorf("ParseFrontmatter() error line = %d, want %d (%v)", fmErr.Line, tt.line, err)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"", "yaml", "TOML", "json"} {
+		if _, err := ParseFormat(name); err != nil {
+			t.Errorf("ParseFormat(%q) error = %v", name, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Errorf("ParseFormat(%q) expected error", "xml")
+	}
+}
@@ -0,0 +1,290 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harperreed/micropub-service/internal/config"
+)
+
+// Layouts maps post types to the location of their files in the repository.
+// The "default" entry applies to post types without a layout of their own.
+var Layouts map[string]config.Layout
+
+// DefaultLayout is used when no layout is configured for a post type.
+var DefaultLayout = config.Layout{Path: "{year}-{month}-{day}-{slug}.md"}
+
+var layoutToken = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// layoutFor returns the layout of postType. Configured layouts take
+// precedence over those of ActiveProfile.
+func layoutFor(postType string) config.Layout {
+	for _, key := range []string{postType, "default"} {
+		if layout, ok := Layouts[key]; ok && layout.Path != "" {
+			return layout
+		}
+		if layout, ok := ActiveProfile.Layouts[key]; ok && layout.Path != "" {
+			return layout
+		}
+	}
+	return DefaultLayout
+}
+
+// propertyText returns the first value of a property as a string.
+func propertyText(properties map[string]interface{}, name string) string {
+	return strings.TrimSpace(contentText(propertyValues(properties[name])))
+}
+
+// postSlug returns the slug of a new post, taken from mp-slug or the name of
+// an article. Other posts, such as notes, get a slug from the time of day.
+func postSlug(properties map[string]interface{}, postType string, t time.Time) string {
+	if slug := sanitizeFilename(propertyText(properties, "mp-slug")); slug != "" {
+		return slug
+	}
+	if postType == TypeArticle {
+		if slug := sanitizeFilename(postTitle(properties)); slug != "" {
+			return slug
+		}
+	}
+	return t.Format("150405")
+}
+
+// postTime returns the publication time of a new post, taken from the
+// published property when it is valid.
+func postTime(properties map[string]interface{}) time.Time {
+	if t, ok := publishedTime(properties); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// PublishedTime returns the published date of a create request, if it has a
+// valid one.
+func PublishedTime(content map[string]interface{}) (time.Time, bool) {
+	properties, _ := content["properties"].(map[string]interface{})
+	return publishedTime(properties)
+}
+
+func publishedTime(properties map[string]interface{}) (time.Time, bool) {
+	published := propertyText(properties, "published")
+	if published == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, published)
+	return t, err == nil
+}
+
+// layoutTokens returns the values of the layout tokens for a post.
+func layoutTokens(postType, slug string, t time.Time) map[string]string {
+	return map[string]string{
+		"year":   t.Format("2006"),
+		"month":  t.Format("01"),
+		"day":    t.Format("02"),
+		"hour":   t.Format("15"),
+		"minute": t.Format("04"),
+		"second": t.Format("05"),
+		"slug":   slug,
+		"id":     strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 36),
+		"type":   postType,
+	}
+}
+
+// expandLayout replaces the tokens of a layout template and returns a clean
+// slash-separated path relative to the repository.
+func expandLayout(template string, tokens map[string]string) (string, error) {
+	var unknown string
+	expanded := layoutToken.ReplaceAllStringFunc(template, func(token string) string {
+		name := token[1 : len(token)-1]
+		value, ok := tokens[name]
+		if !ok && unknown == "" {
+			unknown = token
+		}
+		return value
+	})
+	if unknown != "" {
+		return "", fmt.Errorf("unknown token %s in layout %q", unknown, template)
+	}
+
+	cleaned := path.Clean("/" + expanded)
+	if cleaned == "/" || strings.HasPrefix(expanded, "/") || strings.Contains(expanded, "..") {
+		return "", fmt.Errorf("layout %q does not produce a path inside the repository", template)
+	}
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
+
+// PlanPost chooses the path of a new post from the layout of its type, or the
+// draft layout for drafts, and records it in
+// content["path"], and the discovered type in content["post-type"]. A type
+// already recorded by an earlier plan is kept. It returns the directory,
+// relative to RepoPath, that media uploaded with the post should be stored in.
+func PlanPost(content map[string]interface{}) (string, error) {
+	kind, ok := content["post-type"].(string)
+	if !ok {
+		kind = DiscoverPostType(content)
+	}
+	return planPost(content, kind)
+}
+
+// planPost is PlanPost for a post of type kind.
+func planPost(content map[string]interface{}, kind string) (string, error) {
+	properties, _ := content["properties"].(map[string]interface{})
+	published := postTime(properties)
+	layout := layoutFor(kind)
+	if draft := draftLayout(); draft.Path != "" && IsDraft(properties) {
+		layout = draft
+	}
+	slug := postSlug(properties, kind, published)
+	tokens := layoutTokens(kind, slug, published)
+
+	// Add a counter to the slug until the post does not clash with an
+	// existing one, so that page bundles get a directory of their own
+	var postPath string
+	for i := 1; ; i++ {
+		if i > 1 {
+			tokens["slug"] = fmt.Sprintf("%s-%d", slug, i)
+		}
+		p, err := expandLayout(layout.Path, tokens)
+		if err != nil {
+			return "", err
+		}
+		if i > 1 && !strings.Contains(layout.Path, "{slug}") {
+			ext := path.Ext(p)
+			p = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(p, ext), i, ext)
+		}
+		if _, err := os.Stat(filepath.Join(RepoPath, filepath.FromSlash(p))); os.IsNotExist(err) {
+			postPath = p
+			break
+		}
+	}
+	content["path"] = postPath
+	content["post-type"] = kind
+
+	if layout.Media == "" {
+		return MediaDir, nil
+	}
+	tokens["dir"] = path.Dir(postPath)
+	return expandLayout(layout.Media, tokens)
+}
+
+// ErrNotPost is returned for URLs that do not identify a post in the repository.
+var ErrNotPost = errors.New("not the URL of a post")
+
+// PermalinkBase is the public base URL of the site, e.g.
+// "https://example.com/blog". URLs under it are resolved relative to it.
+var PermalinkBase string
+
+// postFile returns the path, relative to RepoPath, of the post identified by
+// url. Absolute URLs are reduced to their path, less that of PermalinkBase.
+// Both the public URLs of ActiveProfile and the paths of posts in the
+// repository are accepted; when several files could be served at a URL, an
+// existing one is preferred. Only paths one of the layouts could have
+// produced are accepted, so that requests cannot reach the rest of the
+// repository, such as its .git directory.
+func postFile(url string) (string, error) {
+	p := url
+	if base := strings.TrimRight(PermalinkBase, "/"); base != "" && strings.HasPrefix(p, base+"/") {
+		p = strings.TrimPrefix(p, base)
+	} else if i := strings.Index(p, "://"); i >= 0 {
+		p = p[i+3:]
+		if j := strings.Index(p, "/"); j >= 0 {
+			p = p[j:]
+		} else {
+			p = "/"
+		}
+	}
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+
+	var found string
+	for _, candidate := range repositoryPaths(p) {
+		if !safePath(candidate) || !matchesLayout(candidate) {
+			continue
+		}
+		if found == "" {
+			found = candidate
+		}
+		if postExists(candidate) {
+			found = candidate
+			break
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("%w: %s", ErrNotPost, url)
+	}
+	return filepath.FromSlash(found), nil
+}
+
+// safePath reports whether p, a slash-separated path relative to the
+// repository, stays inside it and out of hidden directories.
+func safePath(p string) bool {
+	for _, segment := range strings.Split(p, "/") {
+		// Rejects empty, dot and hidden segments, including .git, and
+		// backslashes, which separate paths on Windows
+		if segment == "" || strings.HasPrefix(segment, ".") || strings.Contains(segment, "\\") {
+			return false
+		}
+	}
+	return true
+}
+
+// postExists reports whether there is a post, or a deleted one, at p.
+func postExists(p string) bool {
+	for _, dir := range []string{RepoPath, filepath.Join(RepoPath, TrashDir)} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(p))); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesLayout reports whether p, a slash-separated path relative to the
+// repository, could have been produced by the layout of a post type or by
+// the draft layout.
+func matchesLayout(p string) bool {
+	templates := []string{layoutFor("").Path, draftLayout().Path}
+	for _, layouts := range []map[string]config.Layout{Layouts, ActiveProfile.Layouts} {
+		for _, layout := range layouts {
+			templates = append(templates, layout.Path)
+		}
+	}
+
+	for _, template := range templates {
+		if template != "" && layoutPattern(template).MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// layoutPattern returns a regular expression matching the paths produced by a
+// layout template. Tokens match a single path segment, and the counter
+// PlanPost adds to clashing paths is allowed before the extension.
+func layoutPattern(template string) *regexp.Regexp {
+	ext := path.Ext(template)
+	if strings.ContainsAny(ext, "{}") {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(template, ext)
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, match := range layoutToken.FindAllStringIndex(stem, -1) {
+		pattern.WriteString(regexp.QuoteMeta(stem[last:match[0]]))
+		pattern.WriteString("[^/]+")
+		last = match[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(stem[last:]))
+	pattern.WriteString("(-[0-9]+)?")
+	pattern.WriteString(regexp.QuoteMeta(ext))
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
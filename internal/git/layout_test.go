@@ -0,0 +1,221 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harperreed/micropub-service/internal/config"
+)
+
+func TestPlanPost(t *testing.T) {
+	originalLayouts := Layouts
+	Layouts = map[string]config.Layout{
+		"note":    {Path: "content/notes/{year}/{month}/{id}.md"},
+		"article": {Path: "content/posts/{slug}.md"},
+		"photo":   {Path: "content/photos/{slug}/index.md", Media: "{dir}"},
+	}
+	defer func() { Layouts = originalLayouts }()
+
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		wantPath   string
+		wantMedia  string
+	}{
+		{
+			name: "Article",
+			properties: map[string]interface{}{
+				"name":    []interface{}{"Hello World"},
+				"content": []interface{}{"Body"},
+			},
+			wantPath:  "content/posts/hello-world.md",
+			wantMedia: MediaDir,
+		},
+		{
+			name: "PhotoBundle",
+			properties: map[string]interface{}{
+				"mp-slug": []interface{}{"Sunset"},
+				"photo":   []interface{}{"https://example.com/sunset.jpg"},
+				"content": []interface{}{"Look"},
+			},
+			wantPath:  "content/photos/sunset/index.md",
+			wantMedia: "content/photos/sunset",
+		},
+		{
+			name: "NoteWithDate",
+			properties: map[string]interface{}{
+				"content":   []interface{}{"Just a note"},
+				"published": []interface{}{"2024-03-05T10:00:00Z"},
+			},
+			wantPath:  "content/notes/2024/03/",
+			wantMedia: MediaDir,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := map[string]interface{}{
+				"type":       []interface{}{"h-entry"},
+				"properties": tt.properties,
+			}
+			mediaDir, err := PlanPost(content)
+			if err != nil {
+				t.Fatalf("PlanPost() error = %v", err)
+			}
+			path, _ := content["path"].(string)
+			if !strings.HasPrefix(path, tt.wantPath) {
+				t.Errorf("PlanPost() path = %q, want prefix %q", path, tt.wantPath)
+			}
+			if mediaDir != tt.wantMedia {
+				t.Errorf("PlanPost() media dir = %q, want %q", mediaDir, tt.wantMedia)
+			}
+		})
+	}
+
+	t.Run("ExistingPost", func(t *testing.T) {
+		existing := filepath.Join(RepoPath, "content", "posts", "taken.md")
+		if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(existing, []byte("Taken"), 0644); err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+
+		content := map[string]interface{}{
+			"properties": map[string]interface{}{"name": []interface{}{"Taken"}},
+		}
+		if _, err := PlanPost(content); err != nil {
+			t.Fatalf("PlanPost() error = %v", err)
+		}
+		if content["path"] != "content/posts/taken-2.md" {
+			t.Errorf("PlanPost() path = %v, want %q", content["path"], "content/posts/taken-2.md")
+		}
+	})
+}
+
+func TestExpandLayout(t *testing.T) {
+	tokens := map[string]string{"year": "2024", "slug": "hello"}
+
+	tests := []struct {
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{"{year}/{slug}.md", "2024/hello.md", false},
+		{"content//posts/./{slug}.md", "content/posts/hello.md", false},
+		{"{unknown}.md", "", true},
+		{"../{slug}.md", "", true},
+		{"/etc/{slug}", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := expandLayout(tt.template, tokens)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("expandLayout(%q) error = %v, wantErr %v", tt.template, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("expandLayout(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestPostFile(t *testing.T) {
+	originalLayouts := Layouts
+	defer func() { Layouts = originalLayouts }()
+	Layouts = map[string]config.Layout{
+		"note": {Path: "content/notes/{year}/{slug}.md"},
+	}
+
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{"/2024-01-01-hello.md", "2024-01-01-hello.md", false},
+		{"/2024-01-01-hello-2.md", "2024-01-01-hello-2.md", false},
+		{"https://example.com/content/notes/2024/hello.md", filepath.Join("content", "notes", "2024", "hello.md"), false},
+		{"/content/notes/2024/hello.md?foo=bar", filepath.Join("content", "notes", "2024", "hello.md"), false},
+		{"/../../etc/passwd", "", true},
+		{"/content/notes/../../2024-01-01-hello.md", "", true},
+		{"https://example.com/.git/config", "", true},
+		{"/content/notes/2024/.hidden.md", "", true},
+		{"/content//notes/2024/hello.md", "", true},
+		{"/README.md", "", true},
+		{"/content/notes/2024/hello.txt", "", true},
+		{"https://example.com", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := postFile(tt.url)
+		if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrNotPost)) {
+			t.Errorf("postFile(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("postFile(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+
+	// The URLs of a site served below a path are relative to it
+	t.Run("PermalinkBaseWithPath", func(t *testing.T) {
+		originalBase := PermalinkBase
+		defer func() { PermalinkBase = originalBase }()
+		PermalinkBase = "https://example.com/blog/"
+
+		for url, want := range map[string]string{
+			"https://example.com/blog/content/notes/2024/hello.md": filepath.Join("content", "notes", "2024", "hello.md"),
+			"/content/notes/2024/hello.md":                         filepath.Join("content", "notes", "2024", "hello.md"),
+		} {
+			if got, err := postFile(url); err != nil || got != want {
+				t.Errorf("postFile(%q) = %q, %v, want %q", url, got, err, want)
+			}
+		}
+		if _, err := postFile("https://example.com/blog/../.git/config"); err == nil {
+			t.Errorf("postFile() resolved a URL outside the layouts")
+		}
+	})
+
+	// The public URLs of a profile lead back to the files they serve
+	t.Run("ProfileURLs", func(t *testing.T) {
+		originalProfile, originalRepoPath := ActiveProfile, RepoPath
+		defer func() { ActiveProfile, RepoPath = originalProfile, originalRepoPath }()
+		RepoPath = t.TempDir()
+		Layouts = nil
+
+		bundle := filepath.Join("content", "photos", "2024", "sunset", "index.md")
+		if err := os.MkdirAll(filepath.Join(RepoPath, filepath.Dir(bundle)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(RepoPath, bundle), []byte("Sunset"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			profile string
+			url     string
+			want    string
+		}{
+			{"hugo", "https://example.com/photos/2024/sunset/", bundle},
+			{"hugo", "/posts/2024/hello/", filepath.Join("content", "posts", "2024", "hello.md")},
+			{"hugo", "/content/posts/2024/hello.md", filepath.Join("content", "posts", "2024", "hello.md")},
+			{"hugo", "/media/2024-03-05-a.jpg", ""},
+			{"hugo", "/.git/config", ""},
+			{"jekyll", "/2024/03/05/hello.html", filepath.Join("_posts", "2024-03-05-hello.md")},
+			{"astro", "/blog/hello/", filepath.Join("src", "content", "blog", "hello.md")},
+		}
+		for _, tt := range tests {
+			ActiveProfile = Profiles[tt.profile]
+			got, err := postFile(tt.url)
+			if (err != nil) != (tt.want == "") || got != tt.want {
+				t.Errorf("%s: postFile(%q) = %q, %v, want %q", tt.profile, tt.url, got, err, tt.want)
+			}
+			if tt.want != "" && !strings.HasPrefix(tt.url, "/content/") {
+				if public := PublicPath(filepath.ToSlash(got)); !strings.HasSuffix(tt.url, public) {
+					t.Errorf("%s: PublicPath(%q) = %q, want the path of %q", tt.profile, got, public, tt.url)
+				}
+			}
+		}
+	})
+}
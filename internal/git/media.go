@@ -0,0 +1,147 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MediaDir is the directory, relative to RepoPath, that uploaded files are stored in.
+var MediaDir = "media"
+
+// PostURL turns the path of a public URL, such as one returned by PublicPath,
+// into an absolute URL. The server sets it to config.Config.PostURL.
+var PostURL = func(path string) string { return path }
+
+// Upload is a file uploaded with a new post. CreatePost stores the uploads in
+// content["uploads"] in the media directory of the post's layout and appends
+// their URLs to the property they were uploaded as.
+type Upload struct {
+	// Property is the media property of the upload, e.g. "photo".
+	Property string
+	// Filename is the name the file was uploaded with.
+	Filename string
+	// Open returns the contents of the file.
+	Open func() (io.ReadCloser, error)
+}
+
+// SaveMedia writes an uploaded file into MediaDir and returns its path relative
+// to RepoPath. The file is not committed; pass the path to CreatePost through
+// content["media"] so it is committed together with the post.
+func SaveMedia(filename string, r io.Reader) (string, error) {
+	return SaveMediaIn(MediaDir, filename, r)
+}
+
+// SaveMediaIn is like SaveMedia but stores the file in mediaDir, a directory
+// relative to RepoPath such as the one returned by PlanPost.
+func SaveMediaIn(mediaDir, filename string, r io.Reader) (string, error) {
+	dir := filepath.Join(RepoPath, filepath.FromSlash(mediaDir))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create media directory: %v", err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	base := sanitizeFilename(strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)))
+	if base == "" {
+		base = "upload"
+	}
+	base = fmt.Sprintf("%s-%s", time.Now().Format("2006-01-02"), base)
+
+	name := base + ext
+	for i := 1; ; i++ {
+		file, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			name = fmt.Sprintf("%s-%d%s", base, i, ext)
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to create media file: %v", err)
+		}
+
+		_, err = io.Copy(file, r)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(file.Name())
+			return "", fmt.Errorf("failed to write media file: %v", err)
+		}
+
+		return path.Join(mediaDir, name), nil
+	}
+}
+
+// DiscardMedia removes uploaded files that were not committed.
+func DiscardMedia(paths []string) {
+	for _, p := range paths {
+		os.Remove(filepath.Join(RepoPath, filepath.FromSlash(p)))
+	}
+}
+
+// StoreUploads stores the uploads of a new post, as CreatePost does, for posts
+// that are queued rather than committed. The stored files are left for
+// CreatePost to commit through content["media"]; when an upload fails, those
+// already stored are removed.
+func StoreUploads(content map[string]interface{}) error {
+	tx := &Tx{}
+	if err := storeUploads(tx, content); err != nil {
+		for _, name := range tx.created {
+			removeCreated(name)
+		}
+		return err
+	}
+	return nil
+}
+
+// storeUploads plans a new post and writes the files in content["uploads"]
+// next to it through tx, so that they are removed when the transaction rolls
+// back. Their URLs are appended to their properties, and their paths to
+// content["media"].
+func storeUploads(tx *Tx, content map[string]interface{}) error {
+	uploads, _ := content["uploads"].([]Upload)
+	delete(content, "uploads")
+	if len(uploads) == 0 {
+		return nil
+	}
+
+	properties, ok := content["properties"].(map[string]interface{})
+	if !ok {
+		properties = make(map[string]interface{})
+		content["properties"] = properties
+	}
+
+	// Media decides the type, and so the layout, of notes and articles
+	uploaded := make(map[string]bool)
+	for _, upload := range uploads {
+		uploaded[upload.Property] = true
+	}
+	kind := DiscoverPostType(content)
+	if kind == TypeNote || kind == TypeArticle {
+		for _, media := range mediaProperties {
+			if uploaded[media.Property] {
+				kind = media.Type
+				break
+			}
+		}
+	}
+	mediaDir, err := planPost(content, kind)
+	if err != nil {
+		return fmt.Errorf("failed to plan post location: %v", err)
+	}
+
+	media, _ := content["media"].([]string)
+	for _, upload := range uploads {
+		p, err := tx.createMedia(mediaDir, upload)
+		if err != nil {
+			return fmt.Errorf("failed to store %s upload: %v", upload.Property, err)
+		}
+		media = append(media, p)
+		properties[upload.Property] = append(propertyValues(properties[upload.Property]), PostURL(PublicPath(p)))
+	}
+	content["media"] = media
+	return nil
+}
@@ -0,0 +1,113 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/harperreed/micropub-service/internal/config"
+)
+
+func TestSaveMedia(t *testing.T) {
+	first, err := SaveMedia("My Photo.JPG", strings.NewReader("first"))
+	if err != nil {
+		t.Fatalf("SaveMedia() error = %v", err)
+	}
+	if !strings.HasPrefix(first, MediaDir+"/") || !strings.HasSuffix(first, "-my-photo.jpg") {
+		t.Errorf("SaveMedia() path = %q, want %s/<date>-my-photo.jpg", first, MediaDir)
+	}
+
+	second, err := SaveMedia("My Photo.JPG", strings.NewReader("second"))
+	if err != nil {
+		t.Fatalf("SaveMedia() error = %v", err)
+	}
+	if second == first {
+		t.Errorf("SaveMedia() reused path %q for a second upload", second)
+	}
+
+	data, err := os.ReadFile(filepath.Join(RepoPath, first))
+	if err != nil || string(data) != "first" {
+		t.Errorf("SaveMedia() stored %q, %v; want %q", data, err, "first")
+	}
+
+	DiscardMedia([]string{first, second})
+	for _, path := range []string{first, second} {
+		if _, err := os.Stat(filepath.Join(RepoPath, path)); !os.IsNotExist(err) {
+			t.Errorf("DiscardMedia() did not remove %s", path)
+		}
+	}
+}
+
+// testUpload returns an upload of data as property.
+func testUpload(property, filename, data string) Upload {
+	return Upload{
+		Property: property,
+		Filename: filename,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(data)), nil
+		},
+	}
+}
+
+func TestStoreUploads(t *testing.T) {
+	originalRepoPath, originalLayouts := RepoPath, Layouts
+	defer func() { RepoPath, Layouts = originalRepoPath, originalLayouts }()
+	RepoPath = t.TempDir()
+	Layouts = map[string]config.Layout{
+		"note":  {Path: "content/notes/{year}/{id}.md"},
+		"photo": {Path: "content/photos/{slug}/index.md", Media: "{dir}"},
+	}
+
+	newPost := func(uploads ...Upload) map[string]interface{} {
+		return map[string]interface{}{
+			"type": []interface{}{"h-entry"},
+			"properties": map[string]interface{}{
+				"mp-slug":   []interface{}{"sunset"},
+				"published": []interface{}{"2024-03-05T10:00:00Z"},
+			},
+			"uploads": uploads,
+		}
+	}
+
+	// A post without a photo URL is planned as a photo, with its upload in
+	// the page bundle
+	content := newPost(testUpload("photo", "Sunset.JPG", "jpeg"))
+	if err := StoreUploads(content); err != nil {
+		t.Fatalf("StoreUploads() error = %v", err)
+	}
+	if content["post-type"] != TypePhoto || content["path"] != "content/photos/sunset/index.md" {
+		t.Errorf("Planned %v at %v, want a photo at content/photos/sunset/index.md", content["post-type"], content["path"])
+	}
+	media, _ := content["media"].([]string)
+	if len(media) != 1 || !strings.HasPrefix(media[0], "content/photos/sunset/") {
+		t.Fatalf("media = %v, want one file in content/photos/sunset/", content["media"])
+	}
+	if data, err := os.ReadFile(filepath.Join(RepoPath, media[0])); err != nil || string(data) != "jpeg" {
+		t.Errorf("Stored %q, %v; want %q", data, err, "jpeg")
+	}
+	properties := content["properties"].(map[string]interface{})
+	if want := []interface{}{"/" + media[0]}; !reflect.DeepEqual(properties["photo"], want) {
+		t.Errorf("photo = %v, want %v", properties["photo"], want)
+	}
+	if _, ok := content["uploads"]; ok {
+		t.Errorf("uploads were left in the content")
+	}
+
+	// Uploads already stored are removed when a later one fails
+	failing := testUpload("photo", "broken.jpg", "")
+	failing.Open = func() (io.ReadCloser, error) {
+		return nil, errors.New("upload lost")
+	}
+	content = newPost(testUpload("photo", "first.jpg", "jpeg"), failing)
+	content["properties"].(map[string]interface{})["mp-slug"] = []interface{}{"broken"}
+	if err := StoreUploads(content); err == nil {
+		t.Fatalf("StoreUploads() succeeded with a failing upload")
+	}
+	if _, err := os.Stat(filepath.Join(RepoPath, "content", "photos", "broken")); !os.IsNotExist(err) {
+		t.Errorf("Page bundle of the failed post was left behind: %v", err)
+	}
+}
@@ -21,6 +21,9 @@ func (m *MockGitOperations) CreatePost(content map[string]interface{}) error {
             title, _ = titleSlice[0].(string)
         }
     }
+    if _, ok := properties["content"]; !ok {
+        return fmt.Errorf("missing content")
+    }
     filename := fmt.Sprintf("%s-%s.md", time.Now().Format("2006-01-02"), sanitizeFilename(title))
     filePath := filepath.Join(RepoPath, filename)
 
@@ -46,7 +49,11 @@ func (m *MockGitOperations) UpdatePost(content map[string]interface{}) error {
     if !ok {
         return fmt.Errorf("invalid URL")
     }
-    filePath := filepath.Join(RepoPath, filepath.Base(url))
+    filename, err := postFile(url)
+    if err != nil {
+        return err
+    }
+    filePath := filepath.Join(RepoPath, filename)
     if _, err := os.Stat(filePath); os.IsNotExist(err) {
         return fmt.Errorf("file not found")
     }
@@ -58,11 +65,27 @@ func (m *MockGitOperations) DeletePost(content map[string]interface{}) error {
     if !ok {
         return fmt.Errorf("invalid URL")
     }
-    filePath := filepath.Join(RepoPath, filepath.Base(url))
-    if _, err := os.Stat(filePath); os.IsNotExist(err) {
-        return fmt.Errorf("file not found")
+    filename, err := postFile(url)
+    if err != nil {
+        return err
+    }
+    trashName := filepath.Join(TrashDir, filename)
+    if _, err := os.Stat(filepath.Join(RepoPath, filename)); err == nil {
+        os.Remove(filepath.Join(RepoPath, trashName))
+    }
+    return movePost(filename, trashName)
+}
+
+func (m *MockGitOperations) UndeletePost(content map[string]interface{}) error {
+    url, ok := content["url"].(string)
+    if !ok {
+        return fmt.Errorf("invalid URL")
+    }
+    filename, err := postFile(url)
+    if err != nil {
+        return err
     }
-    return os.Remove(filePath)
+    return movePost(filepath.Join(TrashDir, filename), filename)
 }
 
 func (m *MockGitOperations) InitializeRepo() error {
@@ -70,7 +93,7 @@ func (m *MockGitOperations) InitializeRepo() error {
     return nil
 }
 
-func (m *MockGitOperations) gitAdd(filename string) error {
+func (m *MockGitOperations) gitAdd(filenames ...string) error {
     // Simulate git add
     return nil
 }
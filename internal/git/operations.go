@@ -3,64 +3,86 @@ package git
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"sort"
 	 "regexp"
-	"gopkg.in/yaml.v2"
 	"strings"
-	"time"
 )
 
 var RepoPath = "./content" // You might want to make this configurable
 
-// GitOperations interface defines the methods for git operations
+// TrashDir is the directory, relative to RepoPath, that deleted posts are moved to.
+var TrashDir = ".trash"
+
+// GitOperations interface defines the methods for git operations.
+// CreatePost sets content["url"] to the path of the public URL of the new
+// post, as returned by PublicPath, and content["queued"] to true when the
+// post was accepted but not yet published.
+// When changes are published through pull requests, the operations set
+// content["pull_request"] to the URL of the pull request opened for them.
 type GitOperations interface {
 	CreatePost(content map[string]interface{}) error
 	UpdatePost(content map[string]interface{}) error
 	DeletePost(content map[string]interface{}) error
+	UndeletePost(content map[string]interface{}) error
 }
 
 
-// DefaultGitOperations is the default implementation of GitOperations
+// DefaultGitOperations is the default implementation of GitOperations. Its
+// operations run one at a time through the Worker of the repository, which
+// pushes their commits in batches or, when Forge is set, opens a pull request
+// for each of them.
 type DefaultGitOperations struct{}
 
 var GitOps GitOperations = &DefaultGitOperations{}
 
+// CreatePost writes a new post, along with its uploaded media, and commits it.
+func (g *DefaultGitOperations) CreatePost(content map[string]interface{}) error {
+	return runOperation(content, createPost)
+}
+
+// UpdatePost applies a Micropub update to a post. Changing the post-status
+// publishes or unpublishes the post in a commit of its own, which moves it
+// when drafts are kept in a draft layout; content["url"] is then set to the
+// new location of the post.
 func (g *DefaultGitOperations) UpdatePost(content map[string]interface{}) error {
-    url, ok := content["url"].(string)
-    if !ok {
-        return fmt.Errorf("invalid URL")
-    }
+	return runOperation(content, updatePost)
+}
 
-    properties, ok := content["properties"].(map[string]interface{})
-    if !ok {
-        return fmt.Errorf("invalid properties")
-    }
+// DeletePost moves the post into TrashDir so it can later be restored with
+// UndeletePost, replacing a post deleted earlier from the same path.
+func (g *DefaultGitOperations) DeletePost(content map[string]interface{}) error {
+	return runOperation(content, deletePost)
+}
 
-    var title, body string
+// UndeletePost restores a post previously removed with DeletePost.
+func (g *DefaultGitOperations) UndeletePost(content map[string]interface{}) error {
+	return runOperation(content, undeletePost)
+}
 
-    if titleValue, ok := properties["title"]; ok {
-        if titleArray, ok := titleValue.([]interface{}); ok && len(titleArray) > 0 {
-            title, _ = titleArray[0].(string)
-        } else if titleStr, ok := titleValue.(string); ok {
-            title = titleStr
-        }
-    }
+// runOperation runs op on content through the worker of the repository. When
+// a pull request was opened for it, content["pull_request"] is set to its URL.
+func runOperation(content map[string]interface{}, op func(tx *Tx, content map[string]interface{}) error) error {
+	var opTx *Tx
+	err := repoWorker().Do(func(tx *Tx) error {
+		opTx = tx
+		return op(tx, content)
+	})
+	if err == nil && opTx.pullRequest != "" {
+		content["pull_request"] = opTx.pullRequest
+	}
+	return err
+}
 
-    if contentValue, ok := properties["content"]; ok {
-        if contentArray, ok := contentValue.([]interface{}); ok && len(contentArray) > 0 {
-            body, _ = contentArray[0].(string)
-        } else if contentStr, ok := contentValue.(string); ok {
-            body = contentStr
-        }
+func updatePost(tx *Tx, content map[string]interface{}) error {
+    url, ok := content["url"].(string)
+    if !ok {
+        return fmt.Errorf("invalid URL")
     }
 
-    if title == "" && body == "" {
-        return fmt.Errorf("no updates provided")
+    filename, err := postFile(url)
+    if err != nil {
+        return err
     }
-
-    filename := filepath.Base(url)
     filePath := filepath.Join(RepoPath, filename)
 
     // Read existing content
@@ -69,158 +91,192 @@ func (g *DefaultGitOperations) UpdatePost(content map[string]interface{}) error
         return fmt.Errorf("failed to read existing file: %v", err)
     }
 
-    // Update content
-    updatedContent := string(existingContent)
-    if title != "" {
-        updatedContent = updateFrontMatter(updatedContent, "title", title)
-    }
-    if body != "" {
-        updatedContent = updateBody(updatedContent, body)
+    frontmatter, body, format, err := ParseFrontmatter(string(existingContent))
+    if err != nil {
+        return fmt.Errorf("failed to parse existing file: %v", err)
     }
 
-    // Write updated content
-    err = os.WriteFile(filePath, []byte(updatedContent), 0644)
+    // Apply the replace, add and delete operations
+    body, err = applyUpdate(frontmatter, strings.TrimLeft(body, "\n"), content)
     if err != nil {
-        return fmt.Errorf("failed to write updated content: %v", err)
+        return err
     }
 
-    if err := gitAdd(filename); err != nil {
-        return err
+    // Keep the format the post was written in
+    updatedContent, err := MarshalFrontmatter(format, frontmatter, "\n"+body)
+    if err != nil {
+        return fmt.Errorf("failed to serialize updated content: %v", err)
     }
 
-    if err := gitCommit(fmt.Sprintf("Update post: %s", filename)); err != nil {
-        return err
+    // An update that only changes the post-status has nothing to commit here
+    if updatedContent != string(existingContent) {
+        if err := tx.writeFile(filename, []byte(updatedContent)); err != nil {
+            return fmt.Errorf("failed to write updated content: %v", err)
+        }
+
+        if err := gitAdd(filename); err != nil {
+            return err
+        }
+
+        if err := tx.commit(newCommitData(ActionUpdate, filename, frontmatter, content)); err != nil {
+            return err
+        }
     }
 
-    if err := gitPush(); err != nil {
-        return err
+    if status := RequestedStatus(content); status != "" {
+        draft := status == StatusDraft
+        if draft != isDraftPost(filename, frontmatter) {
+            if err := changePostStatus(tx, filename, frontmatter, body, format, draft, content); err != nil {
+                return err
+            }
+        }
     }
 
     return nil
 }
 
-// Add this to your git/operations.go file
-func SplitFrontmatterAndContent(content string) (map[string]interface{}, string, error) {
-    parts := strings.SplitN(content, "---", 3)
-    if len(parts) != 3 {
-        return nil, "", fmt.Errorf("invalid frontmatter format")
-    }
+// changePostStatus publishes or unpublishes the post stored at filename and
+// commits the change.
+func changePostStatus(tx *Tx, filename string, frontmatter map[string]interface{}, body string, format Format, draft bool, content map[string]interface{}) error {
+	newName, err := setPostStatus(filename, frontmatter, body, draft)
+	if err != nil {
+		return err
+	}
 
-    var frontmatter map[string]interface{}
-    err := yaml.Unmarshal([]byte(parts[1]), &frontmatter)
-    if err != nil {
-        return nil, "", err
-    }
+	data, err := MarshalFrontmatter(format, frontmatter, "\n"+body)
+	if err != nil {
+		return fmt.Errorf("failed to serialize updated content: %v", err)
+	}
+	if newName != filename {
+		if err := tx.move(filename, newName); err != nil {
+			return fmt.Errorf("failed to move post: %v", err)
+		}
+	}
+	if err := tx.writeFile(newName, []byte(data)); err != nil {
+		return fmt.Errorf("failed to write updated content: %v", err)
+	}
+
+	if err := gitAdd(filename, newName); err != nil {
+		return err
+	}
 
-    return frontmatter, parts[2], nil
+	action := ActionPublish
+	if draft {
+		action = ActionUnpublish
+	}
+	if err := tx.commit(newCommitData(action, newName, frontmatter, content)); err != nil {
+		return err
+	}
+
+	content["url"] = PublicPath(filepath.ToSlash(newName))
+	return nil
 }
 
-func CreateContentWithFrontmatter(frontmatter map[string]interface{}, content string) string {
-    var sb strings.Builder
-    sb.WriteString("---\n")
+// SplitFrontmatterAndContent returns the frontmatter and body of a post,
+// whatever its frontmatter format.
+func SplitFrontmatterAndContent(content string) (map[string]interface{}, string, error) {
+    frontmatter, body, _, err := ParseFrontmatter(content)
+    return frontmatter, body, err
+}
 
-    // Sort the keys for consistent output
-    var keys []string
-    for k := range frontmatter {
-        keys = append(keys, k)
-    }
-    sort.Strings(keys)
+// PostPath returns the location on disk of the post identified by url.
+func PostPath(url string) (string, error) {
+	filename, err := postFile(url)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(RepoPath, filename), nil
+}
 
-    for _, k := range keys {
-        v := frontmatter[k]
-        sb.WriteString(fmt.Sprintf("%s: %v\n", k, v))
-    }
+// ReadPost reads the post identified by url from the repository and returns
+// its frontmatter and body. Drafts have a post-status of draft in place of
+// their draft key.
+func ReadPost(url string) (map[string]interface{}, string, error) {
+	filename, err := postFile(url)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(filepath.Join(RepoPath, filename))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read post: %w", err)
+	}
 
-    sb.WriteString("---\n")
-    sb.WriteString(content)
+	frontmatter, body, err := SplitFrontmatterAndContent(string(data))
+	if err != nil {
+		return nil, "", err
+	}
+	sourceStatus(filename, frontmatter)
 
-    return sb.String()
+	return frontmatter, strings.TrimLeft(body, "\n"), nil
 }
 
-func updateFrontMatter(content, key, value string) string {
-    lines := strings.Split(content, "\n")
-    inFrontMatter := false
-    for i, line := range lines {
-        if line == "---" {
-            inFrontMatter = !inFrontMatter
-            continue
-        }
-        if inFrontMatter && strings.HasPrefix(line, key+":") {
-            lines[i] = fmt.Sprintf("%s: %s", key, value)
-            break
-        }
-    }
-    return strings.Join(lines, "\n")
+// CreateContentWithFrontmatter renders the frontmatter in FrontmatterFormat
+// followed by content.
+func CreateContentWithFrontmatter(frontmatter map[string]interface{}, content string) (string, error) {
+    return MarshalFrontmatter(FrontmatterFormat, frontmatter, content)
 }
 
-func updateBody(content, newBody string) string {
-    parts := strings.SplitN(content, "---", 3)
-    if len(parts) < 3 {
-        return content
-    }
-    return parts[0] + "---" + parts[1] + "---\n" + newBody
+// renderPost returns the file contents of a new post.
+func renderPost(properties map[string]interface{}, postType, body string) (string, error) {
+	return CreateContentWithFrontmatter(postFrontmatter(properties, postType), "\n"+body)
 }
 
-func (g *DefaultGitOperations) CreatePost(content map[string]interface{}) error {
+func createPost(tx *Tx, content map[string]interface{}) error {
     properties, ok := content["properties"].(map[string]interface{})
     if !ok {
         return fmt.Errorf("invalid properties")
     }
 
-    var title, body string
-
-    // Extract title
-    if titleValue, ok := properties["title"]; ok {
-        if titleSlice, ok := titleValue.([]interface{}); ok && len(titleSlice) > 0 {
-            title, _ = titleSlice[0].(string)
-        } else if titleStr, ok := titleValue.(string); ok {
-            title = titleStr
-        }
-    }
-    if title == "" {
-        title = "Untitled Post"
+    // Uploads are stored next to the post, which plans its path
+    if err := storeUploads(tx, content); err != nil {
+        return err
     }
 
-    // Extract content
-    if contentValue, ok := properties["content"]; ok {
-        if contentSlice, ok := contentValue.([]interface{}); ok && len(contentSlice) > 0 {
-            body, _ = contentSlice[0].(string)
-        } else if contentStr, ok := contentValue.(string); ok {
-            body = contentStr
-        }
+    // The type the path was planned for, which counts uploaded media
+    postType, ok := content["post-type"].(string)
+    if !ok {
+        postType = DiscoverPostType(content)
     }
-    if body == "" {
+
+    // Responses such as likes and bookmarks do not need any content
+    body := contentText(propertyValues(properties["content"]))
+    if body == "" && (postType == TypeNote || postType == TypeArticle) {
         return fmt.Errorf("missing content")
     }
 
-    filename := fmt.Sprintf("%s-%s.md", time.Now().Format("2006-01-02"), sanitizeFilename(title))
-    filePath := filepath.Join(RepoPath, filename)
-
-    file, err := os.Create(filePath)
-    if err != nil {
-        return fmt.Errorf("failed to create file: %v", err)
+    // The path is planned by storeUploads, or by the scheduler for queued posts
+    postPath, ok := content["path"].(string)
+    if !ok {
+        if _, err := PlanPost(content); err != nil {
+            return err
+        }
+        postPath = content["path"].(string)
     }
-    defer file.Close()
+    filename := filepath.FromSlash(postPath)
 
-    _, err = fmt.Fprintf(file, "---\ntitle: %s\ndate: %s\n---\n\n%s", title, time.Now().Format(time.RFC3339), body)
+    data, err := renderPost(properties, postType, body)
     if err != nil {
-        return fmt.Errorf("failed to write content to file: %v", err)
+        return fmt.Errorf("failed to serialize post: %v", err)
     }
 
-    if err := gitAdd(filename); err != nil {
-        return err
+    if err := tx.createFile(filename, []byte(data)); err != nil {
+        return fmt.Errorf("failed to create file: %v", err)
     }
 
-    if err := gitCommit(fmt.Sprintf("Add post: %s", title)); err != nil {
+    // Commit uploaded media together with the post
+    media, _ := content["media"].([]string)
+    if err := gitAdd(append([]string{filename}, media...)...); err != nil {
         return err
     }
 
-    if err := gitPush(); err != nil {
+    commit := newCommitData(ActionCreate, filename, nil, content)
+    commit.Type = postType
+    if err := tx.commit(commit); err != nil {
         return err
     }
 
     // Set the URL in the content map
-    content["url"] = fmt.Sprintf("/%s", filename)
+    content["url"] = PublicPath(postPath)
 
     return nil
 }
@@ -233,68 +289,112 @@ func InitializeRepo() error {
 		}
 	}
 
-	cmd := exec.Command("git", "init")
-	cmd.Dir = RepoPath
-	if err := cmd.Run(); err != nil {
+	if err := Repo.Init(); err != nil {
 		return fmt.Errorf("failed to initialize git repository: %v", err)
 	}
 
 	return nil
 }
 
-func gitAdd(filename string) error {
-	cmd := exec.Command("git", "add", filename)
-	cmd.Dir = RepoPath
-	if err := cmd.Run(); err != nil {
+func gitAdd(filenames ...string) error {
+	if err := Repo.Add(filenames...); err != nil {
 		return fmt.Errorf("failed to git add: %v", err)
 	}
 	return nil
 }
 
-func gitCommit(message string) error {
-	cmd := exec.Command("git", "commit", "-m", message)
-	cmd.Dir = RepoPath
-	if err := cmd.Run(); err != nil {
+func gitCommit(message string, author, committer Signature) error {
+	if err := Repo.Commit(message, author, committer); err != nil {
 		return fmt.Errorf("failed to git commit: %v", err)
 	}
 	return nil
 }
 
-func gitPush() error {
-	cmd := exec.Command("git", "push")
-	cmd.Dir = RepoPath
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to git push: %v", err)
-	}
-	return nil
-}
 
 
 
-func (g *DefaultGitOperations) DeletePost(content map[string]interface{}) error {
-	url := content["url"].(string)
-	filename := filepath.Base(url)
-	filePath := filepath.Join(RepoPath, filename)
+func deletePost(tx *Tx, content map[string]interface{}) error {
+	url, ok := content["url"].(string)
+	if !ok {
+		return fmt.Errorf("invalid URL")
+	}
+	filename, err := postFile(url)
+	if err != nil {
+		return err
+	}
+	trashName := filepath.Join(TrashDir, filename)
 
-	if err := os.Remove(filePath); err != nil {
-		return fmt.Errorf("failed to delete file: %v", err)
+	// A post deleted earlier from the same path is replaced, so that the
+	// trash holds the most recent one; the earlier one stays in the history
+	if err := tx.replace(filename, trashName); err != nil {
+		return fmt.Errorf("failed to delete post: %v", err)
 	}
 
-	if err := gitAdd(filename); err != nil {
+	if err := gitAdd(filename, trashName); err != nil {
 		return err
 	}
 
-	if err := gitCommit(fmt.Sprintf("Delete post: %s", filename)); err != nil {
+	if err := tx.commit(newCommitData(ActionDelete, filename, nil, content)); err != nil {
 		return err
 	}
 
-	if err := gitPush(); err != nil {
+	return nil
+}
+
+func undeletePost(tx *Tx, content map[string]interface{}) error {
+	url, ok := content["url"].(string)
+	if !ok {
+		return fmt.Errorf("invalid URL")
+	}
+	filename, err := postFile(url)
+	if err != nil {
+		return err
+	}
+	trashName := filepath.Join(TrashDir, filename)
+
+	if err := tx.move(trashName, filename); err != nil {
+		return fmt.Errorf("failed to undelete post: %v", err)
+	}
+
+	if err := gitAdd(trashName, filename); err != nil {
+		return err
+	}
+
+	if err := tx.commit(newCommitData(ActionUndelete, filename, nil, content)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// movePost renames a file inside the repository, refusing to overwrite an
+// existing file at the destination.
+func movePost(from, to string) error {
+	src := filepath.Join(RepoPath, from)
+	dst := filepath.Join(RepoPath, to)
+
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%s already exists", to)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+// IsDeleted reports whether the post identified by url is in the trash.
+func IsDeleted(url string) bool {
+	filename, err := postFile(url)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(RepoPath, TrashDir, filename))
+	return err == nil
+}
+
 func sanitizeFilename(filename string) string {
     // Replace spaces with hyphens
     sanitized := strings.ReplaceAll(filename, " ", "-")
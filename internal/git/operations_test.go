@@ -3,6 +3,7 @@ package git
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	// "time"
 	"fmt"
@@ -82,7 +83,7 @@ func TestCreatePost(t *testing.T) {
 // TestUpdatePost tests the UpdatePost function
 func TestUpdatePost(t *testing.T) {
 	// Create a test file
-	testFile := filepath.Join(RepoPath, "test-post.md")
+	testFile := filepath.Join(RepoPath, "2024-01-01-test-post.md")
 	initialContent := `---
 title: Initial Title
 date: 2023-05-01T12:00:00Z
@@ -102,7 +103,7 @@ Initial content`
 		{
 			name: "Update title and content",
 			content: map[string]interface{}{
-				"url": "/test-post.md",
+				"url": "/2024-01-01-test-post.md",
 				"properties": map[string]interface{}{
 					"title":   []interface{}{"Updated Title"},
 					"content": []interface{}{"Updated content"},
@@ -144,7 +145,7 @@ Initial content`
 // TestDeletePost tests the DeletePost function
 func TestDeletePost(t *testing.T) {
 	// Create a test file
-	testFile := filepath.Join(RepoPath, "test-delete-post.md")
+	testFile := filepath.Join(RepoPath, "2024-01-01-test-delete-post.md")
 	err := os.WriteFile(testFile, []byte("Test content"), 0644)
 	if err != nil {
 		t.Fatalf("Failed to create test file: %v", err)
@@ -158,7 +159,7 @@ func TestDeletePost(t *testing.T) {
 		{
 			name: "Delete existing post",
 			content: map[string]interface{}{
-				"url": "/test-delete-post.md",
+				"url": "/2024-01-01-test-delete-post.md",
 			},
 			wantErr: false,
 		},
@@ -188,6 +189,180 @@ func TestDeletePost(t *testing.T) {
 	}
 }
 
+func TestUndeletePost(t *testing.T) {
+	testFile := filepath.Join(RepoPath, "2024-01-01-test-undelete-post.md")
+	if err := os.WriteFile(testFile, []byte("Test content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	content := map[string]interface{}{"url": "/2024-01-01-test-undelete-post.md"}
+	if err := GitOps.DeletePost(content); err != nil {
+		t.Fatalf("DeletePost() error = %v", err)
+	}
+	if !IsDeleted("/2024-01-01-test-undelete-post.md") {
+		t.Errorf("IsDeleted() = false after DeletePost()")
+	}
+
+	if err := GitOps.UndeletePost(content); err != nil {
+		t.Fatalf("UndeletePost() error = %v", err)
+	}
+	if _, err := os.Stat(testFile); err != nil {
+		t.Errorf("UndeletePost() file not restored: %v", err)
+	}
+	if IsDeleted("/2024-01-01-test-undelete-post.md") {
+		t.Errorf("IsDeleted() = true after UndeletePost()")
+	}
+
+	if err := GitOps.UndeletePost(map[string]interface{}{"url": "/non-existent.md"}); err == nil {
+		t.Errorf("UndeletePost() expected error for post not in trash")
+	}
+}
+
+func TestReadPost(t *testing.T) {
+	testFile := filepath.Join(RepoPath, "2024-01-01-test-read-post.md")
+	content := "---\ntitle: Read Me\nlocation:\n  name: Chicago\n---\n\nPost body"
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	frontmatter, body, err := ReadPost("https://example.com/2024-01-01-test-read-post.md")
+	if err != nil {
+		t.Fatalf("ReadPost() error = %v", err)
+	}
+	if frontmatter["title"] != "Read Me" {
+		t.Errorf("ReadPost() title = %v, want %v", frontmatter["title"], "Read Me")
+	}
+	if location, ok := frontmatter["location"].(map[string]interface{}); !ok || location["name"] != "Chicago" {
+		t.Errorf("ReadPost() location = %#v, want map with name Chicago", frontmatter["location"])
+	}
+	if body != "Post body" {
+		t.Errorf("ReadPost() body = %q, want %q", body, "Post body")
+	}
+
+	if _, _, err := ReadPost("/non-existent.md"); err == nil {
+		t.Errorf("ReadPost() expected error for missing post")
+	}
+}
+
+func TestApplyUpdate(t *testing.T) {
+	newFrontmatter := func() map[string]interface{} {
+		return map[string]interface{}{
+			"title":    "Initial Title",
+			"category": []interface{}{"go", "indieweb"},
+			"location": "Chicago",
+		}
+	}
+
+	tests := []struct {
+		name     string
+		content  map[string]interface{}
+		want     map[string]interface{}
+		wantBody string
+		wantErr  bool
+	}{
+		{
+			name: "Replace",
+			content: map[string]interface{}{
+				"replace": map[string]interface{}{
+					"title":   []interface{}{"New Title"},
+					"content": []interface{}{"New body"},
+				},
+			},
+			want: map[string]interface{}{
+				"title":    "New Title",
+				"category": []interface{}{"go", "indieweb"},
+				"location": "Chicago",
+			},
+			wantBody: "New body",
+		},
+		{
+			name: "Add",
+			content: map[string]interface{}{
+				"add": map[string]interface{}{
+					"category":    []interface{}{"micropub"},
+					"syndication": []interface{}{"https://mastodon.example/1"},
+				},
+			},
+			want: map[string]interface{}{
+				"title":       "Initial Title",
+				"category":    []interface{}{"go", "indieweb", "micropub"},
+				"location":    "Chicago",
+				"syndication": []interface{}{"https://mastodon.example/1"},
+			},
+			wantBody: "Initial body",
+		},
+		{
+			name: "Delete properties",
+			content: map[string]interface{}{
+				"delete": []interface{}{"location", "content"},
+			},
+			want: map[string]interface{}{
+				"title":    "Initial Title",
+				"category": []interface{}{"go", "indieweb"},
+			},
+			wantBody: "",
+		},
+		{
+			name: "Delete values",
+			content: map[string]interface{}{
+				"delete": map[string]interface{}{
+					"category": []interface{}{"indieweb"},
+					"location": []interface{}{"Chicago"},
+				},
+			},
+			want: map[string]interface{}{
+				"title":    "Initial Title",
+				"category": []interface{}{"go"},
+			},
+			wantBody: "Initial body",
+		},
+		{
+			name: "Combined",
+			content: map[string]interface{}{
+				"replace": map[string]interface{}{"title": []interface{}{"Combined"}},
+				"add":     map[string]interface{}{"category": []interface{}{"micropub"}},
+				"delete":  []interface{}{"location"},
+			},
+			want: map[string]interface{}{
+				"title":    "Combined",
+				"category": []interface{}{"go", "indieweb", "micropub"},
+			},
+			wantBody: "Initial body",
+		},
+		{
+			name:    "No operations",
+			content: map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name: "Add to content",
+			content: map[string]interface{}{
+				"add": map[string]interface{}{"content": []interface{}{"More"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frontmatter := newFrontmatter()
+			body, err := applyUpdate(frontmatter, "Initial body", tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(frontmatter, tt.want) {
+				t.Errorf("applyUpdate() frontmatter = %#v, want %#v", frontmatter, tt.want)
+			}
+			if body != tt.wantBody {
+				t.Errorf("applyUpdate() body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
 // Add more test functions for other operations here
 
 func TestSanitizeFilename(t *testing.T) {
@@ -0,0 +1,90 @@
+package git
+
+import (
+	"regexp"
+	"strings"
+)
+
+// URLRule maps the repository paths matching Path to the public URLs
+// matching URL, and back. Both are templates with the tokens of layouts and
+// {path}, which stands for any number of path segments, and must have the
+// same tokens. URL is the path of the URL, without the PermalinkBase.
+type URLRule struct {
+	Path string
+	URL  string
+}
+
+// tokenPatterns holds the regular expressions matched by the tokens of URL
+// rules that do not stand for a single path segment.
+var tokenPatterns = map[string]string{
+	"path":   ".+",
+	"year":   "[0-9]{4}",
+	"month":  "[0-9]{2}",
+	"day":    "[0-9]{2}",
+	"hour":   "[0-9]{2}",
+	"minute": "[0-9]{2}",
+	"second": "[0-9]{2}",
+}
+
+// PublicPath returns the path of the public URL of the file at p, a
+// slash-separated path relative to RepoPath, following the URL rules of
+// ActiveProfile. The first rule matching p is used; files that no rule
+// matches are served at their path in the repository.
+func PublicPath(p string) string {
+	for _, rule := range ActiveProfile.URLs {
+		if u, ok := rewritePath(p, rule.Path, rule.URL); ok {
+			return u
+		}
+	}
+	return "/" + p
+}
+
+// repositoryPaths returns the slash-separated paths, relative to RepoPath,
+// of the files that could be served at the URL path p: those of the URL
+// rules of ActiveProfile matching p, followed by p itself.
+func repositoryPaths(p string) []string {
+	var paths []string
+	for _, rule := range ActiveProfile.URLs {
+		if file, ok := rewritePath(p, rule.URL, rule.Path); ok {
+			paths = append(paths, strings.TrimPrefix(file, "/"))
+		}
+	}
+	return append(paths, strings.TrimPrefix(p, "/"))
+}
+
+// rewritePath matches p against the template from and, when it matches,
+// returns the template to with the tokens replaced by their values in p.
+func rewritePath(p, from, to string) (string, bool) {
+	pattern := templatePattern(from)
+	match := pattern.FindStringSubmatch(p)
+	if match == nil {
+		return "", false
+	}
+	return layoutToken.ReplaceAllStringFunc(to, func(token string) string {
+		if i := pattern.SubexpIndex(token[1 : len(token)-1]); i >= 0 {
+			return match[i]
+		}
+		return ""
+	}), true
+}
+
+// templatePattern returns a regular expression matching the paths produced
+// by a URL rule template, with a named group for each of its tokens.
+func templatePattern(template string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, match := range layoutToken.FindAllStringSubmatchIndex(template, -1) {
+		name := template[match[2]:match[3]]
+		token, ok := tokenPatterns[name]
+		if !ok {
+			token = "[^/]+"
+		}
+		pattern.WriteString(regexp.QuoteMeta(template[last:match[0]]))
+		pattern.WriteString("(?P<" + name + ">" + token + ")")
+		last = match[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
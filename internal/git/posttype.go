@@ -0,0 +1,179 @@
+package git
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Post types returned by DiscoverPostType.
+const (
+	TypeNote     = "note"
+	TypeArticle  = "article"
+	TypeReply    = "reply"
+	TypeRepost   = "repost"
+	TypeLike     = "like"
+	TypeBookmark = "bookmark"
+	TypeRSVP     = "rsvp"
+	TypeCheckin  = "checkin"
+	TypeVideo    = "video"
+	TypePhoto    = "photo"
+	TypeAudio    = "audio"
+)
+
+// responseProperties maps the properties that make a post a response to the
+// type of the post, in discovery order.
+var responseProperties = []struct {
+	Property string
+	Type     string
+}{
+	{"in-reply-to", TypeReply},
+	{"repost-of", TypeRepost},
+	{"like-of", TypeLike},
+	{"bookmark-of", TypeBookmark},
+}
+
+// mediaProperties maps media properties to the type of the post, in
+// discovery order.
+var mediaProperties = []struct {
+	Property string
+	Type     string
+}{
+	{"video", TypeVideo},
+	{"photo", TypePhoto},
+	{"audio", TypeAudio},
+}
+
+var (
+	htmlTag    = regexp.MustCompile(`<[^>]*>`)
+	whitespace = regexp.MustCompile(`\s+`)
+)
+
+// DiscoverPostType implements Post Type Discovery
+// (https://ptd.spec.indieweb.org/) on a Micropub create request. Objects
+// other than h-entry are reported by their type without the "h-" prefix,
+// e.g. "event".
+func DiscoverPostType(content map[string]interface{}) string {
+	if types := propertyValues(content["type"]); len(types) > 0 {
+		if t, ok := types[0].(string); ok && t != "" && t != "h-entry" {
+			return strings.TrimPrefix(t, "h-")
+		}
+	}
+
+	properties, _ := content["properties"].(map[string]interface{})
+
+	switch strings.ToLower(propertyText(properties, "rsvp")) {
+	case "yes", "no", "maybe", "interested":
+		return TypeRSVP
+	}
+
+	for _, response := range responseProperties {
+		if hasURL(properties[response.Property]) {
+			return response.Type
+		}
+	}
+
+	if properties["checkin"] != nil {
+		return TypeCheckin
+	}
+
+	for _, media := range mediaProperties {
+		if properties[media.Property] != nil {
+			return media.Type
+		}
+	}
+
+	if isArticle(properties) {
+		return TypeArticle
+	}
+	return TypeNote
+}
+
+// isArticle reports whether the post has a name that is not just the start of
+// its content.
+func isArticle(properties map[string]interface{}) bool {
+	name := collapseWhitespace(postTitle(properties))
+	if name == "" {
+		return false
+	}
+
+	text := plainText(propertyValues(properties["content"]))
+	if text == "" {
+		text = plainText(propertyValues(properties["summary"]))
+	}
+	return !strings.HasPrefix(collapseWhitespace(text), name)
+}
+
+// postTitle returns the name of the post. The non-standard title property is
+// accepted as well.
+func postTitle(properties map[string]interface{}) string {
+	if name := propertyText(properties, "name"); name != "" {
+		return name
+	}
+	return propertyText(properties, "title")
+}
+
+// hasURL reports whether a property holds a URL or an embedded h-cite with one.
+func hasURL(value interface{}) bool {
+	for _, v := range propertyValues(value) {
+		switch item := v.(type) {
+		case string:
+			if strings.HasPrefix(item, "http://") || strings.HasPrefix(item, "https://") {
+				return true
+			}
+		case map[string]interface{}:
+			if properties, ok := item["properties"].(map[string]interface{}); ok && hasURL(properties["url"]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// plainText returns the text of the first value of a content property,
+// preferring the plain text value over HTML.
+func plainText(values []interface{}) string {
+	if len(values) == 0 {
+		return ""
+	}
+	if v, ok := values[0].(map[string]interface{}); ok {
+		if text, ok := v["value"].(string); ok {
+			return text
+		}
+		if html, ok := v["html"].(string); ok {
+			return htmlTag.ReplaceAllString(html, "")
+		}
+	}
+	return contentText(values)
+}
+
+func collapseWhitespace(s string) string {
+	return strings.TrimSpace(whitespace.ReplaceAllString(s, " "))
+}
+
+// postFrontmatter returns the frontmatter of a new post. Every property
+// except content is kept under the key given by FrontmatterKey, together with
+// the date of the post, its discovered type and, for drafts, the draft key.
+func postFrontmatter(properties map[string]interface{}, postType string) map[string]interface{} {
+	frontmatter := make(map[string]interface{}, len(properties)+2)
+	for name, value := range properties {
+		if !isStoredProperty(name) {
+			continue
+		}
+		if values := propertyValues(value); len(values) > 0 {
+			frontmatter[FrontmatterKey(name)] = propertyValue(name, values)
+		}
+	}
+
+	if key := FrontmatterKey("published"); key != "-" {
+		if _, ok := frontmatter[key]; !ok {
+			frontmatter[key] = postTime(properties).Format(time.RFC3339)
+		}
+	}
+	if key := draftKey(); key != "" && IsDraft(properties) {
+		frontmatter[key] = true
+	}
+	frontmatter["post-type"] = postType
+
+	return frontmatter
+}
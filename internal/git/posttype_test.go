@@ -0,0 +1,79 @@
+package git
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiscoverPostType(t *testing.T) {
+	tests := []struct {
+		name    string
+		content map[string]interface{}
+		want    string
+	}{
+		{"Note", entry(map[string]interface{}{"content": []interface{}{"Hello"}}), TypeNote},
+		{"Article", entry(map[string]interface{}{"name": []interface{}{"My Trip"}, "content": []interface{}{"It was great"}}), TypeArticle},
+		{"NameIsContentPrefix", entry(map[string]interface{}{"name": []interface{}{"Hello  world"}, "content": []interface{}{"Hello world, again"}}), TypeNote},
+		{"ArticleWithHTML", entry(map[string]interface{}{"name": []interface{}{"Title"}, "content": []interface{}{map[string]interface{}{"html": "<p>Body</p>"}}}), TypeArticle},
+		{"Reply", entry(map[string]interface{}{"in-reply-to": []interface{}{"https://example.com/post"}, "content": []interface{}{"Agreed"}}), TypeReply},
+		{"ReplyWithoutURL", entry(map[string]interface{}{"in-reply-to": []interface{}{"not a url"}, "content": []interface{}{"Agreed"}}), TypeNote},
+		{"Repost", entry(map[string]interface{}{"repost-of": []interface{}{"https://example.com/post"}}), TypeRepost},
+		{"Like", entry(map[string]interface{}{"like-of": "https://example.com/post"}), TypeLike},
+		{"BookmarkCite", entry(map[string]interface{}{"bookmark-of": []interface{}{map[string]interface{}{
+			"type":       []interface{}{"h-cite"},
+			"properties": map[string]interface{}{"url": []interface{}{"https://example.com/post"}},
+		}}}), TypeBookmark},
+		{"RSVP", entry(map[string]interface{}{"rsvp": []interface{}{"Yes"}, "in-reply-to": []interface{}{"https://example.com/event"}}), TypeRSVP},
+		{"Checkin", entry(map[string]interface{}{"checkin": []interface{}{map[string]interface{}{"type": []interface{}{"h-card"}}}}), TypeCheckin},
+		{"Photo", entry(map[string]interface{}{"photo": []interface{}{"https://example.com/a.jpg"}, "name": []interface{}{"Sunset"}}), TypePhoto},
+		{"Video", entry(map[string]interface{}{"video": []interface{}{"https://example.com/a.mp4"}, "photo": []interface{}{"https://example.com/a.jpg"}}), TypeVideo},
+		{"Event", map[string]interface{}{"type": []interface{}{"h-event"}, "properties": map[string]interface{}{}}, "event"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiscoverPostType(tt.content); got != tt.want {
+				t.Errorf("DiscoverPostType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostFrontmatter(t *testing.T) {
+	published := "2024-03-05T10:00:00Z"
+
+	reply := postFrontmatter(map[string]interface{}{
+		"in-reply-to": []interface{}{"https://example.com/post"},
+		"content":     []interface{}{"Agreed"},
+		"published":   []interface{}{published},
+	}, TypeReply)
+	if reply["in-reply-to"] != "https://example.com/post" || reply["post-type"] != TypeReply || reply["date"] != published {
+		t.Errorf("postFrontmatter() reply = %#v", reply)
+	}
+	if _, ok := reply["title"]; ok {
+		t.Errorf("postFrontmatter() added a title to a reply")
+	}
+
+	article := postFrontmatter(map[string]interface{}{"name": []interface{}{"My Trip"}}, TypeArticle)
+	if article["title"] != "My Trip" {
+		t.Errorf("postFrontmatter() article title = %v", article["title"])
+	}
+}
+
+func TestPostSlug(t *testing.T) {
+	at := time.Date(2024, 3, 5, 10, 4, 5, 0, time.UTC)
+
+	if got := postSlug(map[string]interface{}{"content": []interface{}{"Hi"}}, TypeNote, at); got != "100405" {
+		t.Errorf("postSlug() note = %q, want %q", got, "100405")
+	}
+	if got := postSlug(map[string]interface{}{"name": []interface{}{"My Trip"}}, TypeArticle, at); got != "my-trip" {
+		t.Errorf("postSlug() article = %q, want %q", got, "my-trip")
+	}
+	if got := postSlug(map[string]interface{}{"mp-slug": []interface{}{"Custom"}, "name": []interface{}{"My Trip"}}, TypeArticle, at); got != "custom" {
+		t.Errorf("postSlug() mp-slug = %q, want %q", got, "custom")
+	}
+}
+
+func entry(properties map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": []interface{}{"h-entry"}, "properties": properties}
+}
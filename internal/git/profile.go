@@ -0,0 +1,151 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/harperreed/micropub-service/internal/config"
+)
+
+// Profile describes how a static site generator expects posts to be written:
+// the frontmatter format, the keys properties are stored under, where posts
+// and media go and how drafts are marked. Configured layouts and property
+// mappings take precedence over those of the profile.
+type Profile struct {
+	// Name is the name the profile is selected by in the configuration.
+	Name string
+
+	// Format is the frontmatter format of new posts.
+	Format Format
+
+	// PropertyMap maps Micropub properties to frontmatter keys, on top of
+	// DefaultPropertyMap.
+	PropertyMap map[string]string
+
+	// Layouts maps post types to the location of their files, with a
+	// "default" entry for other post types.
+	Layouts map[string]config.Layout
+
+	// MediaDir is the directory, relative to the repository, that uploaded
+	// files are stored in.
+	MediaDir string
+
+	// URLs maps the files of the repository, posts and media alike, to the
+	// URLs the generator serves them at.
+	URLs []URLRule
+
+	// DraftKey is the frontmatter key set to true on drafts, e.g. "draft".
+	DraftKey string
+
+	// DraftLayout, when set, is used for drafts instead of the layout of
+	// their post type, for generators that keep drafts in a directory of
+	// their own.
+	DraftLayout config.Layout
+}
+
+// ActiveProfile is the profile new posts are written with. The zero Profile
+// adds nothing to the configured layouts and property mappings.
+var ActiveProfile Profile
+
+// Profiles holds the built-in static site generator profiles by name.
+var Profiles = map[string]Profile{
+	"hugo": {
+		Name:   "hugo",
+		Format: FormatTOML,
+		PropertyMap: map[string]string{
+			"category": "tags",
+			"updated":  "lastmod",
+		},
+		Layouts: map[string]config.Layout{
+			"default": {Path: "content/posts/{year}/{slug}.md"},
+			"note":    {Path: "content/notes/{year}/{id}.md"},
+			"photo":   {Path: "content/photos/{year}/{slug}/index.md", Media: "{dir}"},
+		},
+		MediaDir: "static/media",
+		URLs: []URLRule{
+			{Path: "content/{path}/index.md", URL: "/{path}/"},
+			{Path: "content/{path}.md", URL: "/{path}/"},
+			{Path: "content/{path}", URL: "/{path}"},
+			{Path: "static/{path}", URL: "/{path}"},
+		},
+		DraftKey: "draft",
+	},
+	"jekyll": {
+		Name:   "jekyll",
+		Format: FormatYAML,
+		PropertyMap: map[string]string{
+			"category": "categories",
+			"summary":  "excerpt",
+			"updated":  "last_modified_at",
+		},
+		Layouts: map[string]config.Layout{
+			"default": {Path: "_posts/{year}-{month}-{day}-{slug}.md"},
+		},
+		MediaDir: "assets/media",
+		// The date permalink style, without the categories Jekyll adds
+		// by default
+		URLs: []URLRule{
+			{Path: "_posts/{year}-{month}-{day}-{slug}.md", URL: "/{year}/{month}/{day}/{slug}.html"},
+		},
+		DraftLayout: config.Layout{Path: "_drafts/{slug}.md"},
+	},
+	"eleventy": {
+		Name:   "eleventy",
+		Format: FormatYAML,
+		PropertyMap: map[string]string{
+			"category": "tags",
+			"summary":  "description",
+		},
+		Layouts: map[string]config.Layout{
+			"default": {Path: "posts/{year}/{slug}.md"},
+			"note":    {Path: "notes/{year}/{id}.md"},
+		},
+		MediaDir: "media",
+		URLs: []URLRule{
+			{Path: "{path}/index.md", URL: "/{path}/"},
+			{Path: "{path}.md", URL: "/{path}/"},
+		},
+		DraftKey: "draft",
+	},
+	"astro": {
+		Name:   "astro",
+		Format: FormatYAML,
+		PropertyMap: map[string]string{
+			"category":  "tags",
+			"published": "pubDate",
+			"updated":   "updatedDate",
+			"summary":   "description",
+		},
+		Layouts: map[string]config.Layout{
+			"default": {Path: "src/content/blog/{slug}.md"},
+			"note":    {Path: "src/content/notes/{id}.md"},
+		},
+		MediaDir: "public/media",
+		// The routes of the blog template, which serve collections at
+		// their name
+		URLs: []URLRule{
+			{Path: "src/content/{collection}/{path}.md", URL: "/{collection}/{path}/"},
+			{Path: "public/{path}", URL: "/{path}"},
+		},
+		DraftKey: "draft",
+	},
+}
+
+// LookupProfile returns the built-in profile called name. An empty name
+// selects the zero Profile.
+func LookupProfile(name string) (Profile, error) {
+	if name == "" {
+		return Profile{}, nil
+	}
+	if profile, ok := Profiles[strings.ToLower(name)]; ok {
+		return profile, nil
+	}
+
+	names := make([]string, 0, len(Profiles))
+	for n := range Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return Profile{}, fmt.Errorf("unknown profile %q, expected one of %s", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,113 @@
+package git
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestProfiles(t *testing.T) {
+	posts := []struct {
+		name       string
+		properties map[string]interface{}
+	}{
+		{
+			name: "article",
+			properties: map[string]interface{}{
+				"name":      []interface{}{"Hello World"},
+				"content":   []interface{}{"The first post.\n\n---\n\nWith a rule."},
+				"summary":   []interface{}{"A greeting"},
+				"category":  []interface{}{"indieweb", "go"},
+				"published": []interface{}{"2024-03-05T10:00:00Z"},
+			},
+		},
+		{
+			name: "note",
+			properties: map[string]interface{}{
+				"content":   []interface{}{"Just a note"},
+				"published": []interface{}{"2024-03-05T10:00:00Z"},
+			},
+		},
+		{
+			name: "photo",
+			properties: map[string]interface{}{
+				"mp-slug":   []interface{}{"sunset"},
+				"content":   []interface{}{"Look at this"},
+				"photo":     []interface{}{"https://example.com/sunset.jpg"},
+				"published": []interface{}{"2024-03-05T10:00:00Z"},
+			},
+		},
+		{
+			name: "draft",
+			properties: map[string]interface{}{
+				"name":        []interface{}{"Work in Progress"},
+				"content":     []interface{}{"Not done yet"},
+				"post-status": []interface{}{"draft"},
+				"published":   []interface{}{"2024-03-05T10:00:00Z"},
+			},
+		},
+	}
+
+	originalProfile, originalFormat, originalMediaDir := ActiveProfile, FrontmatterFormat, MediaDir
+	defer func() {
+		ActiveProfile, FrontmatterFormat, MediaDir = originalProfile, originalFormat, originalMediaDir
+	}()
+
+	for name, profile := range Profiles {
+		ActiveProfile, FrontmatterFormat, MediaDir = profile, profile.Format, profile.MediaDir
+
+		for _, post := range posts {
+			t.Run(name+"/"+post.name, func(t *testing.T) {
+				content := map[string]interface{}{
+					"type":       []interface{}{"h-entry"},
+					"properties": post.properties,
+				}
+				mediaDir, err := PlanPost(content)
+				if err != nil {
+					t.Fatalf("PlanPost() error = %v", err)
+				}
+				postType := content["post-type"].(string)
+				body := contentText(propertyValues(post.properties["content"]))
+				data, err := renderPost(post.properties, postType, body)
+				if err != nil {
+					t.Fatalf("renderPost() error = %v", err)
+				}
+
+				postPath := content["path"].(string)
+				got := "path: " + postPath + "\nurl: " + PublicPath(postPath) +
+					"\nmedia: " + mediaDir + "\nmedia url: " + PublicPath(mediaDir+"/a.jpg") + "\n\n" + data
+				golden := filepath.Join("testdata", "profiles", name, post.name+".golden")
+				if *update {
+					if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("Failed to read golden file: %v", err)
+				}
+				if got != string(want) {
+					t.Errorf("%s mismatch:\n%s\nwant:\n%s", golden, got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestLookupProfile(t *testing.T) {
+	for _, name := range []string{"", "hugo", "Jekyll", "eleventy", "astro"} {
+		if _, err := LookupProfile(name); err != nil {
+			t.Errorf("LookupProfile(%q) error = %v", name, err)
+		}
+	}
+	if _, err := LookupProfile("gatsby"); err == nil {
+		t.Errorf("LookupProfile(%q) expected error", "gatsby")
+	}
+}
@@ -0,0 +1,79 @@
+package git
+
+import "strings"
+
+// PropertyMap maps Micropub property names to frontmatter keys, e.g.
+// "category" to "tags". It is applied on top of the property map of
+// ActiveProfile and DefaultPropertyMap. Mapping a
+// property to "-" leaves it out of the frontmatter.
+var PropertyMap map[string]string
+
+// DefaultPropertyMap holds the frontmatter keys used by most static site
+// generators for standard properties. post-status is not stored as such;
+// drafts are marked by their draft key or draft layout instead.
+var DefaultPropertyMap = map[string]string{
+	"name":        "title",
+	"published":   "date",
+	"mp-slug":     "slug",
+	"post-status": "-",
+}
+
+// ListProperties are always stored as lists, even with a single value, so
+// that templates can range over them.
+var ListProperties = map[string]bool{
+	"category":    true,
+	"syndication": true,
+}
+
+// FrontmatterKey returns the frontmatter key a property is stored under, or
+// "-" when the property is not stored.
+func FrontmatterKey(property string) string {
+	if key, ok := PropertyMap[property]; ok && key != "" {
+		return key
+	}
+	if key, ok := ActiveProfile.PropertyMap[property]; ok && key != "" {
+		return key
+	}
+	if key, ok := DefaultPropertyMap[property]; ok {
+		return key
+	}
+	return property
+}
+
+// PropertyName returns the property stored under a frontmatter key. It is the
+// reverse of FrontmatterKey.
+func PropertyName(key string) string {
+	for _, m := range []map[string]string{PropertyMap, ActiveProfile.PropertyMap, DefaultPropertyMap} {
+		for property, mapped := range m {
+			if mapped == key && FrontmatterKey(property) == key {
+				return property
+			}
+		}
+	}
+	return key
+}
+
+// isStoredProperty reports whether a property of a create request is kept in
+// the frontmatter. Micropub commands (mp-*) are only kept when mapped
+// explicitly, as mp-slug is.
+func isStoredProperty(property string) bool {
+	if property == "content" || FrontmatterKey(property) == "-" {
+		return false
+	}
+	if strings.HasPrefix(property, "mp-") {
+		_, custom := PropertyMap[property]
+		_, profile := ActiveProfile.PropertyMap[property]
+		_, standard := DefaultPropertyMap[property]
+		return custom || profile || standard
+	}
+	return true
+}
+
+// propertyValue returns the frontmatter value of a property: a scalar for
+// single values, unless the property is in ListProperties, and a list otherwise.
+func propertyValue(property string, values []interface{}) interface{} {
+	if ListProperties[property] {
+		return values
+	}
+	return frontmatterValue(values)
+}
@@ -0,0 +1,95 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPostFrontmatterPreservesProperties(t *testing.T) {
+	originalMap := PropertyMap
+	PropertyMap = map[string]string{"category": "tags", "mp-syndicate-to": "syndicate-to", "summary": "-"}
+	defer func() { PropertyMap = originalMap }()
+
+	location := map[string]interface{}{
+		"type": []interface{}{"h-card"},
+		"properties": map[string]interface{}{
+			"name":     []interface{}{"Chicago"},
+			"latitude": []interface{}{"41.88"},
+		},
+	}
+	properties := map[string]interface{}{
+		"name":            []interface{}{"My Trip"},
+		"content":         []interface{}{"It was great"},
+		"summary":         []interface{}{"A trip"},
+		"category":        []interface{}{"travel"},
+		"photo":           []interface{}{"https://example.com/a.jpg", "https://example.com/b.jpg"},
+		"published":       []interface{}{"2024-03-05T10:00:00Z"},
+		"location":        []interface{}{location},
+		"syndication":     "https://mastodon.example/1",
+		"mp-slug":         []interface{}{"trip"},
+		"mp-syndicate-to": []interface{}{"https://mastodon.example/@me"},
+		"mp-destination":  []interface{}{"https://example.com/"},
+	}
+
+	want := map[string]interface{}{
+		"title":        "My Trip",
+		"tags":         []interface{}{"travel"},
+		"photo":        []interface{}{"https://example.com/a.jpg", "https://example.com/b.jpg"},
+		"date":         "2024-03-05T10:00:00Z",
+		"location":     location,
+		"syndication":  []interface{}{"https://mastodon.example/1"},
+		"slug":         "trip",
+		"syndicate-to": "https://mastodon.example/@me",
+		"post-type":    TypePhoto,
+	}
+
+	if got := postFrontmatter(properties, TypePhoto); !reflect.DeepEqual(got, want) {
+		t.Errorf("postFrontmatter() = %#v, want %#v", got, want)
+	}
+}
+
+func TestPropertyName(t *testing.T) {
+	originalMap := PropertyMap
+	PropertyMap = map[string]string{"category": "tags", "name": "-"}
+	defer func() { PropertyMap = originalMap }()
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"tags", "category"},
+		{"date", "published"},
+		{"slug", "mp-slug"},
+		{"title", "title"},
+		{"location", "location"},
+	}
+
+	for _, tt := range tests {
+		if got := PropertyName(tt.key); got != tt.want {
+			t.Errorf("PropertyName(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+		if tt.want != tt.key && FrontmatterKey(tt.want) != tt.key {
+			t.Errorf("FrontmatterKey(%q) = %q, want %q", tt.want, FrontmatterKey(tt.want), tt.key)
+		}
+	}
+}
+
+func TestApplyUpdateWithPropertyMap(t *testing.T) {
+	originalMap := PropertyMap
+	PropertyMap = map[string]string{"category": "tags"}
+	defer func() { PropertyMap = originalMap }()
+
+	frontmatter := map[string]interface{}{"title": "Post", "tags": []interface{}{"go"}}
+	content := map[string]interface{}{
+		"replace": map[string]interface{}{"name": []interface{}{"Renamed"}},
+		"add":     map[string]interface{}{"category": []interface{}{"indieweb"}},
+	}
+	if _, err := applyUpdate(frontmatter, "", content); err != nil {
+		t.Fatalf("applyUpdate() error = %v", err)
+	}
+
+	want := map[string]interface{}{"title": "Renamed", "tags": []interface{}{"go", "indieweb"}}
+	if !reflect.DeepEqual(frontmatter, want) {
+		t.Errorf("applyUpdate() frontmatter = %#v, want %#v", frontmatter, want)
+	}
+}
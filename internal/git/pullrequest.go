@@ -0,0 +1,132 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/harperreed/micropub-service/internal/forge"
+)
+
+// Forge, when set, makes operations open pull requests instead of pushing to
+// the current branch: the commits of each operation are pushed to a branch
+// of their own, named after the post, and a pull request is opened to merge
+// it into the current branch. The current branch is not committed to; it is
+// updated from its remote before each operation, so that posts whose pull
+// requests were merged can be read, updated and deleted.
+var Forge forge.Client
+
+// BranchPrefix is prepended to the names of the branches pull requests are
+// opened from.
+var BranchPrefix = "micropub/"
+
+// pendingBranch is the local branch operations are committed on before they
+// are pushed for a pull request.
+const pendingBranch = "micropub-pending"
+
+// runPullRequest updates the current branch from its remote, runs op on a
+// branch of its own, pushes the branch and opens a pull request against the
+// current branch. The working tree is back on the current branch when it
+// returns.
+func (w *Worker) runPullRequest(op func(tx *Tx) error) error {
+	base, err := w.backend.Branch()
+	if err != nil {
+		return fmt.Errorf("failed to read the current branch: %v", err)
+	}
+	if base == pendingBranch {
+		// A previous operation could not switch back to its base
+		if w.base == "" {
+			return fmt.Errorf("the working tree is on %s and the branch to open pull requests against is unknown", pendingBranch)
+		}
+		base = w.base
+		if err := w.backend.Checkout(base, false); err != nil {
+			return fmt.Errorf("failed to check out %s: %v", base, err)
+		}
+	}
+	w.base = base
+
+	// Start from the base as it is upstream, where earlier pull requests may
+	// have been merged
+	if err := w.backend.Sync(); err != nil {
+		return fmt.Errorf("failed to update %s: %v", base, err)
+	}
+
+	// Resets the branch when an earlier operation failed to delete it
+	if err := w.backend.Checkout(pendingBranch, true); err != nil {
+		return fmt.Errorf("failed to create branch: %v", err)
+	}
+
+	tx, err := w.runTx(op)
+	if err == nil && len(tx.commits) > 0 {
+		if err = w.openPullRequest(tx, base); err != nil {
+			// Keep uploads around for a retry, as when a push fails
+			if rerr := tx.rollback(w.backend); rerr != nil {
+				err = fmt.Errorf("%v; rollback failed: %v", err, rerr)
+			}
+		}
+	}
+
+	var cleanup error
+	if cerr := w.backend.Checkout(base, false); cerr != nil {
+		cleanup = fmt.Errorf("failed to check out %s: %v", base, cerr)
+	} else if derr := w.backend.DeleteBranch(pendingBranch); derr != nil {
+		cleanup = fmt.Errorf("failed to delete branch %s: %v", pendingBranch, derr)
+	}
+	if cleanup == nil {
+		return err
+	}
+	if err == nil {
+		// The next operation recovers, whereas a client told that this one
+		// failed would retry it and open a second pull request
+		log.Printf("Operation succeeded, but cleaning up after it failed: %v", cleanup)
+		return nil
+	}
+	return errors.Join(err, cleanup)
+}
+
+// openPullRequest pushes the commits of tx to a new branch and opens a pull
+// request to merge them into base.
+func (w *Worker) openPullRequest(tx *Tx, base string) error {
+	head, err := w.backend.Head()
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD: %v", err)
+	}
+	first := tx.commits[0]
+	branch := BranchPrefix + first.Slug + "-" + head[:7]
+	if err := w.backend.PushBranch(pendingBranch, branch); err != nil {
+		return fmt.Errorf("failed to git push: %v", err)
+	}
+
+	title, _, _ := strings.Cut(tx.messages[0], "\n")
+	url, err := w.Forge.CreatePullRequest(context.Background(), forge.PullRequest{
+		Title: title,
+		Body:  pullRequestBody(tx),
+		Head:  branch,
+		Base:  base,
+	})
+	if err != nil {
+		return fmt.Errorf("branch %s was pushed, but the pull request could not be opened: %v", branch, err)
+	}
+	tx.pullRequest = url
+	return nil
+}
+
+// pullRequestBody describes the commits of tx and who asked for them.
+func pullRequestBody(tx *Tx) string {
+	var body strings.Builder
+	for _, message := range tx.messages {
+		title, _, _ := strings.Cut(message, "\n")
+		fmt.Fprintf(&body, "- %s\n", title)
+	}
+	data := tx.commits[0]
+	if data.Me != "" {
+		fmt.Fprintf(&body, "\nRequested by %s", data.Me)
+		if data.Client != "" {
+			fmt.Fprintf(&body, " with %s", data.Client)
+		}
+		body.WriteString(".\n")
+	}
+	return strings.TrimRight(body.String(), "\n")
+}
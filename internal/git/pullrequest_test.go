@@ -0,0 +1,264 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/harperreed/micropub-service/internal/forge"
+	"github.com/harperreed/micropub-service/internal/forge/forgetest"
+)
+
+func TestPullRequests(t *testing.T) {
+	backends := []struct {
+		name    string
+		backend Backend
+	}{
+		{BackendCLI, CLIBackend{}},
+		{BackendGoGit, GoGitBackend{}},
+	}
+
+	for _, tt := range backends {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == BackendCLI {
+				if _, err := exec.LookPath("git"); err != nil {
+					t.Skip("git is not installed")
+				}
+			}
+			testPullRequests(t, tt.backend)
+		})
+	}
+}
+
+// flakyBackend fails to check out a branch once.
+type flakyBackend struct {
+	Backend
+	failCheckout string
+}
+
+func (f *flakyBackend) Checkout(branch string, create bool) error {
+	if branch == f.failCheckout && !create {
+		f.failCheckout = ""
+		return errors.New("index.lock exists")
+	}
+	return f.Backend.Checkout(branch, create)
+}
+
+// testPullRequests creates a post in pull request mode and checks that it was
+// pushed to a branch of its own, with a pull request opened for it, while the
+// current branch was left alone.
+func testPullRequests(t *testing.T, backend Backend) {
+	server := forgetest.NewServer()
+	defer server.Close()
+	client, err := forge.New(forge.GitHub, server.URL, "alice/blog", "secret")
+	if err != nil {
+		t.Fatalf("forge.New() error = %v", err)
+	}
+	originalForge := Forge
+	defer func() { Forge = originalForge }()
+	Forge = client
+
+	flaky := &flakyBackend{Backend: backend}
+	repo, remote := newTestRepo(t, flaky)
+
+	// Pull requests need a branch to be merged into
+	if err := os.WriteFile(filepath.Join(RepoPath, "README.md"), []byte("Blog\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Repo.Add("README.md"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := Repo.Commit("Initial commit", Signature{}, Signature{}); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if err := Repo.Push(); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	base, err := Repo.Branch()
+	if err != nil {
+		t.Fatalf("Branch() error = %v", err)
+	}
+	initial, err := repo.Head()
+	if err != nil {
+		t.Fatalf("Failed to read HEAD: %v", err)
+	}
+	baseHead := initial.Hash()
+
+	upload := func(name string) {
+		t.Helper()
+		path := filepath.Join(RepoPath, "media", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("jpeg"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newPost := func(slug string) map[string]interface{} {
+		return map[string]interface{}{
+			"type": []interface{}{"h-entry"},
+			"properties": map[string]interface{}{
+				"content":   []interface{}{"Hello"},
+				"mp-slug":   []interface{}{slug},
+				"published": []interface{}{"2024-03-05T10:00:00Z"},
+			},
+			"media": []string{"media/" + slug + ".jpg"},
+			"me":    "https://example.com/",
+		}
+	}
+	// checkBase checks that the current branch and the working tree are as
+	// they were, apart from untracked files
+	checkBase := func(t *testing.T, untracked ...string) {
+		t.Helper()
+		if current, err := Repo.Branch(); err != nil || current != base {
+			t.Errorf("Current branch = %q, %v, want %q", current, err, base)
+		}
+		if head, err := repo.Head(); err != nil || head.Hash() != baseHead {
+			t.Errorf("HEAD moved from %s", baseHead)
+		}
+		if _, err := repo.Reference(plumbing.NewBranchReferenceName(pendingBranch), true); err == nil {
+			t.Errorf("Branch %s was left behind", pendingBranch)
+		}
+		worktree, err := repo.Worktree()
+		if err != nil {
+			t.Fatalf("Failed to open worktree: %v", err)
+		}
+		status, err := worktree.Status()
+		if err != nil {
+			t.Fatalf("Failed to read status: %v", err)
+		}
+		want := map[string]bool{}
+		for _, name := range untracked {
+			want[name] = true
+		}
+		for name, file := range status {
+			if !want[name] || file.Staging != gogit.Untracked {
+				t.Errorf("Unexpected change to %s: %c%c", name, file.Staging, file.Worktree)
+			}
+			delete(want, name)
+		}
+		for name := range want {
+			t.Errorf("Untracked file %s was removed", name)
+		}
+	}
+
+	upload("hello.jpg")
+	post := newPost("hello")
+	if err := (&DefaultGitOperations{}).CreatePost(post); err != nil {
+		t.Fatalf("CreatePost() error = %v", err)
+	}
+	if want := server.URL + "/alice/blog/pull/1"; post["pull_request"] != want {
+		t.Errorf("pull_request = %v, want %s", post["pull_request"], want)
+	}
+	if post["url"] != "/2024-03-05-hello.md" {
+		t.Errorf("url = %v, want /2024-03-05-hello.md", post["url"])
+	}
+
+	// The post and its media moved to the branch of the pull request
+	checkBase(t)
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("Forge received %d pull requests, want 1", len(requests))
+	}
+	pr := requests[0]
+	if !strings.HasPrefix(pr.Head, "micropub/2024-03-05-hello-") || pr.Base != base {
+		t.Errorf("Pull request from %s into %s, want from micropub/2024-03-05-hello-* into %s", pr.Head, pr.Base, base)
+	}
+	if pr.Title != "Add note: 2024-03-05-hello.md" || !strings.Contains(pr.Body, "Requested by https://example.com/") {
+		t.Errorf("Pull request = %q: %q", pr.Title, pr.Body)
+	}
+	branch, err := remote.Reference(plumbing.NewBranchReferenceName(pr.Head), true)
+	if err != nil {
+		t.Fatalf("Branch %s was not pushed: %v", pr.Head, err)
+	}
+	tree := commitTree(t, remote, branch.Hash())
+	for _, name := range []string{"2024-03-05-hello.md", "media/hello.jpg", "README.md"} {
+		if _, err := tree.File(name); err != nil {
+			t.Errorf("%s is not on the branch: %v", name, err)
+		}
+	}
+	if pushed, err := remote.Reference(plumbing.NewBranchReferenceName(base), true); err != nil || pushed.Hash() != initial.Hash() {
+		t.Errorf("Branch %s was pushed to", base)
+	}
+
+	// A pull request that cannot be opened is rolled back, keeping uploads
+	server.Fail("Validation Failed")
+	upload("again.jpg")
+	if err := (&DefaultGitOperations{}).CreatePost(newPost("again")); err == nil || !strings.Contains(err.Error(), "Validation Failed") {
+		t.Errorf("CreatePost() error = %v, want the error of the forge", err)
+	}
+	checkBase(t, "media/again.jpg")
+
+	// A pull request that was opened is not reported as failed when switching
+	// back to the base fails, and the next operation starts from the base
+	flaky.failCheckout = base
+	server.Fail("")
+	stuck := newPost("stuck")
+	stuck["media"] = nil
+	if err := (&DefaultGitOperations{}).CreatePost(stuck); err != nil {
+		t.Fatalf("CreatePost() error = %v", err)
+	}
+	if stuck["pull_request"] == nil {
+		t.Errorf("pull_request was not set")
+	}
+	next := newPost("next")
+	next["media"] = nil
+	if err := (&DefaultGitOperations{}).CreatePost(next); err != nil {
+		t.Fatalf("CreatePost() error = %v", err)
+	}
+	checkBase(t, "media/again.jpg")
+	requests = server.Requests()
+	if pr := requests[len(requests)-1]; pr.Base != base {
+		t.Errorf("Pull request into %s, want %s", pr.Base, base)
+	} else {
+		branch, err := remote.Reference(plumbing.NewBranchReferenceName(pr.Head), true)
+		if err != nil {
+			t.Fatalf("Branch %s was not pushed: %v", pr.Head, err)
+		}
+		if _, err := commitTree(t, remote, branch.Hash()).File("2024-03-05-stuck.md"); err == nil {
+			t.Errorf("Pull request of the next post includes the previous one")
+		}
+	}
+
+	// Once the first pull request is merged upstream, its post can be updated
+	merged := plumbing.NewHashReference(plumbing.NewBranchReferenceName(base), branch.Hash())
+	if err := remote.Storer.SetReference(merged); err != nil {
+		t.Fatalf("Failed to merge %s: %v", pr.Head, err)
+	}
+	update := map[string]interface{}{
+		"action":  "update",
+		"url":     "/2024-03-05-hello.md",
+		"replace": map[string]interface{}{"content": []interface{}{"Updated"}},
+	}
+	if err := (&DefaultGitOperations{}).UpdatePost(update); err != nil {
+		t.Fatalf("UpdatePost() error = %v", err)
+	}
+	baseHead = branch.Hash()
+	checkBase(t, "media/again.jpg")
+	requests = server.Requests()
+	pr = requests[len(requests)-1]
+	updated, err := remote.Reference(plumbing.NewBranchReferenceName(pr.Head), true)
+	if err != nil {
+		t.Fatalf("Branch %s was not pushed: %v", pr.Head, err)
+	}
+	commit, err := remote.CommitObject(updated.Hash())
+	if err != nil {
+		t.Fatalf("Failed to read commit: %v", err)
+	}
+	if len(commit.ParentHashes) != 1 || commit.ParentHashes[0] != branch.Hash() {
+		t.Errorf("Pull request of the update starts from %v, want the merged %s", commit.ParentHashes, branch.Hash())
+	}
+	file, err := commitTree(t, remote, updated.Hash()).File("2024-03-05-hello.md")
+	if err != nil {
+		t.Fatalf("Updated post is not on the branch: %v", err)
+	}
+	if contents, _ := file.Contents(); !strings.Contains(contents, "Updated") {
+		t.Errorf("Updated post = %q", contents)
+	}
+}
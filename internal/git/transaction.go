@@ -0,0 +1,162 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Tx is the transaction of an operation on the repository. Files are written
+// through it atomically, and the files it creates are recorded so that the
+// operation can be rolled back when it fails.
+type Tx struct {
+	// head is the commit checked out when the transaction began.
+	head    string
+	created []string
+
+	// commits and messages describe the commits made in the transaction.
+	commits  []CommitData
+	messages []string
+	// pullRequest is the URL of the pull request opened for the commits.
+	pullRequest string
+}
+
+// begin starts a transaction at the commit checked out in backend.
+func begin(backend Backend) (*Tx, error) {
+	head, err := backend.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HEAD: %v", err)
+	}
+	return &Tx{head: head}, nil
+}
+
+// createFile writes a new file at name, relative to RepoPath, failing when it
+// already exists.
+func (tx *Tx) createFile(name string, data []byte) error {
+	if _, err := os.Lstat(filepath.Join(RepoPath, name)); err == nil {
+		return fmt.Errorf("%s already exists", name)
+	}
+	return tx.writeFile(name, data)
+}
+
+// writeFile replaces the file at name, relative to RepoPath, atomically: the
+// data is written to a temporary file next to it, which is then renamed.
+func (tx *Tx) writeFile(name string, data []byte) error {
+	path := filepath.Join(RepoPath, name)
+	_, err := os.Lstat(path)
+	created := os.IsNotExist(err)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	if created {
+		tx.created = append(tx.created, name)
+	}
+	return nil
+}
+
+// createMedia stores an upload in mediaDir with SaveMediaIn and returns its
+// path relative to RepoPath.
+func (tx *Tx) createMedia(mediaDir string, upload Upload) (string, error) {
+	file, err := upload.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	p, err := SaveMediaIn(mediaDir, upload.Filename, file)
+	if err != nil {
+		return "", err
+	}
+	tx.created = append(tx.created, filepath.FromSlash(p))
+	return p, nil
+}
+
+// move renames a post inside the repository with movePost.
+func (tx *Tx) move(from, to string) error {
+	if err := movePost(from, to); err != nil {
+		return err
+	}
+	tx.created = append(tx.created, to)
+	return nil
+}
+
+// replace is like move but replaces the file at to, which must be tracked so
+// that a rollback restores it.
+func (tx *Tx) replace(from, to string) error {
+	if _, err := os.Lstat(filepath.Join(RepoPath, to)); err != nil {
+		return tx.move(from, to)
+	}
+	if err := os.Remove(filepath.Join(RepoPath, to)); err != nil {
+		return err
+	}
+	return movePost(from, to)
+}
+
+// rollback restores the index and working tree to the commit the transaction
+// began at, removing the files it created.
+func (tx *Tx) rollback(backend Backend) error {
+	return rollback(backend, tx.head, tx)
+}
+
+// rollback resets backend to head and removes the files created by txs, along
+// with the directories left empty.
+func rollback(backend Backend, head string, txs ...*Tx) error {
+	var errs []error
+	if err := backend.Reset(head); err != nil {
+		errs = append(errs, fmt.Errorf("failed to reset to %s: %v", head, err))
+	}
+	for _, tx := range txs {
+		for i := len(tx.created) - 1; i >= 0; i-- {
+			if err := removeCreated(tx.created[i]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// removeCreated removes a file created in a transaction, and its parent
+// directories up to RepoPath once they are empty.
+func removeCreated(name string) error {
+	path := filepath.Join(RepoPath, name)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	root := filepath.Clean(RepoPath)
+	for dir := filepath.Dir(path); dir != root && dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		// Fails, and stops, at the first directory that is not empty
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
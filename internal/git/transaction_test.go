@@ -0,0 +1,232 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+)
+
+// failingBackend fails commits or pushes on demand.
+type failingBackend struct {
+	Backend
+	failCommit bool
+	failPush   bool
+}
+
+func (f *failingBackend) Commit(message string, author, committer Signature) error {
+	if f.failCommit {
+		return errors.New("commit failed")
+	}
+	return f.Backend.Commit(message, author, committer)
+}
+
+func (f *failingBackend) Push() error {
+	if f.failPush {
+		return errors.New("push rejected")
+	}
+	return f.Backend.Push()
+}
+
+func TestRollback(t *testing.T) {
+	backends := []struct {
+		name    string
+		backend Backend
+	}{
+		{BackendCLI, CLIBackend{}},
+		{BackendGoGit, GoGitBackend{}},
+	}
+
+	for _, tt := range backends {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == BackendCLI {
+				if _, err := exec.LookPath("git"); err != nil {
+					t.Skip("git is not installed")
+				}
+			}
+			testRollback(t, tt.backend)
+		})
+	}
+}
+
+// testRollback fails the commit or push of each operation and checks that
+// the repository is left as it was.
+func testRollback(t *testing.T, backend Backend) {
+	failing := &failingBackend{Backend: backend}
+	repo, _ := newTestRepo(t, failing)
+	ops := &DefaultGitOperations{}
+
+	newPost := func(slug string) map[string]interface{} {
+		return map[string]interface{}{
+			"type": []interface{}{"h-entry"},
+			"properties": map[string]interface{}{
+				"content":   []interface{}{"Hello"},
+				"mp-slug":   []interface{}{slug},
+				"published": []interface{}{"2024-03-05T10:00:00Z"},
+			},
+		}
+	}
+	post := newPost("hello")
+	if err := ops.CreatePost(post); err != nil {
+		t.Fatalf("CreatePost() error = %v", err)
+	}
+	original, err := os.ReadFile(filepath.Join(RepoPath, "2024-03-05-hello.md"))
+	if err != nil {
+		t.Fatalf("Failed to read post: %v", err)
+	}
+
+	// Uploaded media is not tracked yet and must survive rollbacks
+	mediaPath := filepath.Join(RepoPath, "media", "upload.jpg")
+	if err := os.MkdirAll(filepath.Dir(mediaPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mediaPath, []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// checkRolledBack checks that HEAD did not move, that the post is as it
+	// was and that nothing but the upload is left over
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("Failed to read HEAD: %v", err)
+	}
+	checkRolledBack := func(t *testing.T) {
+		t.Helper()
+		current, err := repo.Head()
+		if err != nil {
+			t.Fatalf("Failed to read HEAD: %v", err)
+		}
+		if current.Hash() != head.Hash() {
+			t.Errorf("HEAD = %s, want %s", current.Hash(), head.Hash())
+		}
+		data, err := os.ReadFile(filepath.Join(RepoPath, "2024-03-05-hello.md"))
+		if err != nil || string(data) != string(original) {
+			t.Errorf("Post = %q, %v, want %q", data, err, original)
+		}
+		worktree, err := repo.Worktree()
+		if err != nil {
+			t.Fatalf("Failed to open worktree: %v", err)
+		}
+		status, err := worktree.Status()
+		if err != nil {
+			t.Fatalf("Failed to read status: %v", err)
+		}
+		for name, file := range status {
+			if name != "media/upload.jpg" || file.Staging != gogit.Untracked {
+				t.Errorf("Unexpected change to %s: %c%c", name, file.Staging, file.Worktree)
+			}
+		}
+		if _, err := os.Stat(mediaPath); err != nil {
+			t.Errorf("Upload was removed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(RepoPath, TrashDir)); !os.IsNotExist(err) {
+			t.Errorf("Trash directory was left behind: %v", err)
+		}
+	}
+
+	t.Run("CreateCommitFails", func(t *testing.T) {
+		failing.failCommit = true
+		defer func() { failing.failCommit = false }()
+		post := newPost("second")
+		post["media"] = []string{"media/upload.jpg"}
+		if err := ops.CreatePost(post); err == nil {
+			t.Fatalf("CreatePost() succeeded")
+		}
+		if _, err := os.Stat(filepath.Join(RepoPath, "2024-03-05-second.md")); !os.IsNotExist(err) {
+			t.Errorf("New post was left behind: %v", err)
+		}
+		checkRolledBack(t)
+	})
+
+	// Uploads are stored in the transaction of the post and removed with it
+	t.Run("UploadCommitFails", func(t *testing.T) {
+		failing.failCommit = true
+		defer func() { failing.failCommit = false }()
+		post := newPost("third")
+		post["uploads"] = []Upload{testUpload("photo", "sunset.jpg", "jpeg")}
+		if err := ops.CreatePost(post); err == nil {
+			t.Fatalf("CreatePost() succeeded")
+		}
+		media, _ := post["media"].([]string)
+		if len(media) != 1 {
+			t.Fatalf("media = %v, want the stored upload", post["media"])
+		}
+		if _, err := os.Stat(filepath.Join(RepoPath, media[0])); !os.IsNotExist(err) {
+			t.Errorf("Upload of the failed post was left behind: %v", err)
+		}
+		checkRolledBack(t)
+	})
+
+	t.Run("UpdatePushFails", func(t *testing.T) {
+		failing.failPush = true
+		defer func() { failing.failPush = false }()
+		update := map[string]interface{}{
+			"url":     post["url"],
+			"replace": map[string]interface{}{"content": []interface{}{"Changed"}},
+		}
+		if err := ops.UpdatePost(update); err == nil {
+			t.Fatalf("UpdatePost() succeeded")
+		}
+		checkRolledBack(t)
+	})
+
+	t.Run("DeleteCommitFails", func(t *testing.T) {
+		failing.failCommit = true
+		defer func() { failing.failCommit = false }()
+		if err := ops.DeletePost(map[string]interface{}{"url": post["url"]}); err == nil {
+			t.Fatalf("DeletePost() succeeded")
+		}
+		checkRolledBack(t)
+	})
+
+	// The repository is usable once the failures are over
+	update := map[string]interface{}{
+		"url":     post["url"],
+		"replace": map[string]interface{}{"content": []interface{}{"Changed"}},
+	}
+	if err := ops.UpdatePost(update); err != nil {
+		t.Fatalf("UpdatePost() error = %v", err)
+	}
+
+	// A post deleted from the path of a deleted post replaces it in the trash
+	if err := ops.DeletePost(map[string]interface{}{"url": post["url"]}); err != nil {
+		t.Fatalf("DeletePost() error = %v", err)
+	}
+	trashed := filepath.Join(RepoPath, TrashDir, "2024-03-05-hello.md")
+	first, err := os.ReadFile(trashed)
+	if err != nil {
+		t.Fatalf("Deleted post is not in the trash: %v", err)
+	}
+	again := newPost("hello")
+	again["properties"].(map[string]interface{})["content"] = []interface{}{"Hello again"}
+	if err := ops.CreatePost(again); err != nil {
+		t.Fatalf("CreatePost() error = %v", err)
+	}
+	if again["url"] != post["url"] {
+		t.Fatalf("url = %v, want the path of the deleted post %v", again["url"], post["url"])
+	}
+
+	failing.failCommit = true
+	if err := ops.DeletePost(map[string]interface{}{"url": again["url"]}); err == nil {
+		t.Fatalf("DeletePost() succeeded")
+	}
+	failing.failCommit = false
+	if data, err := os.ReadFile(trashed); err != nil || string(data) != string(first) {
+		t.Errorf("Trashed post after a failed delete = %q, %v, want %q", data, err, first)
+	}
+
+	if err := ops.DeletePost(map[string]interface{}{"url": again["url"]}); err != nil {
+		t.Fatalf("DeletePost() of a post deleted before error = %v", err)
+	}
+	if err := ops.UndeletePost(map[string]interface{}{"url": again["url"]}); err != nil {
+		t.Fatalf("UndeletePost() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(RepoPath, "2024-03-05-hello.md"))
+	if err != nil || !strings.Contains(string(data), "Hello again") {
+		t.Errorf("Undeleted post = %q, %v, want the most recent one", data, err)
+	}
+}
@@ -0,0 +1,147 @@
+package git
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// applyUpdate applies the Micropub replace, add and delete operations found in
+// content to the frontmatter and body of a post and returns the new body.
+// The content property maps to the body; every other property maps to the
+// frontmatter key given by FrontmatterKey.
+func applyUpdate(frontmatter map[string]interface{}, body string, content map[string]interface{}) (string, error) {
+	replace, hasReplace := content["replace"].(map[string]interface{})
+	add, hasAdd := content["add"].(map[string]interface{})
+	remove, hasDelete := content["delete"]
+
+	if !hasReplace && !hasAdd && !hasDelete {
+		return body, fmt.Errorf("no updates provided")
+	}
+
+	for name, value := range replace {
+		values := propertyValues(value)
+		if name == "content" {
+			body = contentText(values)
+			continue
+		}
+		key := FrontmatterKey(name)
+		if key == "-" {
+			continue
+		}
+		if len(values) == 0 {
+			delete(frontmatter, key)
+			continue
+		}
+		frontmatter[key] = propertyValue(name, values)
+	}
+
+	for name, value := range add {
+		if name == "content" {
+			return body, fmt.Errorf("cannot add values to content")
+		}
+		key := FrontmatterKey(name)
+		if key == "-" {
+			continue
+		}
+		values := append(propertyValues(frontmatter[key]), propertyValues(value)...)
+		if len(values) > 0 {
+			frontmatter[key] = propertyValue(name, values)
+		}
+	}
+
+	switch remove := remove.(type) {
+	case nil:
+	case []interface{}:
+		for _, key := range remove {
+			name, ok := key.(string)
+			if !ok {
+				return body, fmt.Errorf("invalid property name in delete: %v", key)
+			}
+			if name == "content" {
+				body = ""
+				continue
+			}
+			delete(frontmatter, FrontmatterKey(name))
+		}
+	case map[string]interface{}:
+		for name, value := range remove {
+			if name == "content" {
+				body = ""
+				continue
+			}
+			key := FrontmatterKey(name)
+			remaining := removeValues(propertyValues(frontmatter[key]), propertyValues(value))
+			if len(remaining) == 0 {
+				delete(frontmatter, key)
+			} else {
+				frontmatter[key] = propertyValue(name, remaining)
+			}
+		}
+	default:
+		return body, fmt.Errorf("invalid delete data")
+	}
+
+	return body, nil
+}
+
+// propertyValues returns value as a slice, wrapping single values.
+func propertyValues(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return append([]interface{}(nil), v...)
+	case []string:
+		values := make([]interface{}, len(v))
+		for i, s := range v {
+			values[i] = s
+		}
+		return values
+	default:
+		return []interface{}{v}
+	}
+}
+
+// frontmatterValue stores single values as scalars and multiple values as lists.
+func frontmatterValue(values []interface{}) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+// contentText extracts the post body from a content property, which is either
+// a plain string or an object with an html or value key.
+func contentText(values []interface{}) string {
+	if len(values) == 0 {
+		return ""
+	}
+	switch v := values[0].(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		for _, key := range []string{"html", "value"} {
+			if text, ok := v[key].(string); ok {
+				return text
+			}
+		}
+	}
+	return fmt.Sprintf("%v", values[0])
+}
+
+func removeValues(values, remove []interface{}) []interface{} {
+	var remaining []interface{}
+	for _, value := range values {
+		keep := true
+		for _, r := range remove {
+			if reflect.DeepEqual(value, r) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			remaining = append(remaining, value)
+		}
+	}
+	return remaining
+}
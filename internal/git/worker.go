@@ -0,0 +1,146 @@
+package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/harperreed/micropub-service/internal/forge"
+)
+
+// Worker runs the operations on a repository one at a time, so that
+// concurrent requests do not race on the working tree and index. Operations
+// queued while others run form a batch whose commits are pushed together once
+// the batch is done.
+//
+// Each operation runs in a transaction: when it fails, the repository is
+// rolled back to the commit it started from. When a push fails, the whole
+// batch is rolled back.
+type Worker struct {
+	// Forge, when set, makes the worker open a pull request for each
+	// operation instead of pushing to the current branch.
+	Forge forge.Client
+
+	backend Backend
+	// base is the branch pull requests are opened against, remembered for
+	// when an operation fails to switch back to it.
+	base string
+
+	mu      sync.Mutex
+	queue   []*job
+	running bool
+}
+
+type job struct {
+	op   func(tx *Tx) error
+	done chan error
+}
+
+// NewWorker creates a Worker for the repository driven by backend.
+func NewWorker(backend Backend) *Worker {
+	return &Worker{backend: backend}
+}
+
+// Do queues op and waits for its result. When op succeeds, its commits are
+// pushed with the rest of its batch and the error of the push, if any, is
+// returned instead.
+func (w *Worker) Do(op func(tx *Tx) error) error {
+	j := &job{op: op, done: make(chan error, 1)}
+
+	w.mu.Lock()
+	w.queue = append(w.queue, j)
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+	w.mu.Unlock()
+
+	return <-j.done
+}
+
+// run works through the queue batch by batch, and exits once it is empty.
+func (w *Worker) run() {
+	for {
+		w.mu.Lock()
+		batch := w.queue
+		w.queue = nil
+		if len(batch) == 0 {
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+		w.mu.Unlock()
+
+		if w.Forge != nil {
+			for _, j := range batch {
+				j.done <- w.runPullRequest(j.op)
+			}
+			continue
+		}
+
+		var committed []*job
+		var txs []*Tx
+		for _, j := range batch {
+			tx, err := w.runTx(j.op)
+			if err != nil {
+				j.done <- err
+				continue
+			}
+			committed = append(committed, j)
+			txs = append(txs, tx)
+		}
+		if len(committed) == 0 {
+			continue
+		}
+
+		err := w.backend.Push()
+		if err != nil {
+			err = fmt.Errorf("failed to git push: %v", err)
+			if rerr := rollback(w.backend, txs[0].head, txs...); rerr != nil {
+				err = fmt.Errorf("%v; rollback failed: %v", err, rerr)
+			}
+		}
+		for _, j := range committed {
+			j.done <- err
+		}
+	}
+}
+
+// runTx runs op in a transaction, rolling it back when op fails.
+func (w *Worker) runTx(op func(tx *Tx) error) (*Tx, error) {
+	tx, err := begin(w.backend)
+	if err != nil {
+		return nil, err
+	}
+	if err := op(tx); err != nil {
+		if rerr := tx.rollback(w.backend); rerr != nil {
+			err = fmt.Errorf("%v; rollback failed: %v", err, rerr)
+		}
+		return nil, err
+	}
+	return tx, nil
+}
+
+var (
+	workersMu sync.Mutex
+	workers   = map[string]*Worker{}
+)
+
+// repoWorker returns the Worker of the repository at RepoPath, driven by Repo
+// and opening pull requests on Forge.
+func repoWorker() *Worker {
+	key := filepath.Clean(RepoPath)
+	if abs, err := filepath.Abs(key); err == nil {
+		key = abs
+	}
+
+	workersMu.Lock()
+	defer workersMu.Unlock()
+	w, ok := workers[key]
+	if !ok {
+		w = NewWorker(Repo)
+		w.Forge = Forge
+		workers[key] = w
+	}
+	return w
+}
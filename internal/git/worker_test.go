@@ -0,0 +1,204 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// fakeBackend counts pushes, failing them with pushErr, and records resets.
+type fakeBackend struct {
+	Backend
+	pushErr error
+
+	mu     sync.Mutex
+	pushes int
+	resets []string
+}
+
+func (f *fakeBackend) Push() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pushes++
+	return f.pushErr
+}
+
+func (f *fakeBackend) Head() (string, error) {
+	return "abc123", nil
+}
+
+func (f *fakeBackend) Reset(commit string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resets = append(f.resets, commit)
+	return nil
+}
+
+func TestWorkerBatchesPushes(t *testing.T) {
+	backend := &fakeBackend{}
+	w := NewWorker(backend)
+
+	var running int32
+	op := func(tx *Tx) error {
+		if atomic.AddInt32(&running, 1) != 1 {
+			t.Errorf("Operations ran concurrently")
+		}
+		defer atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	// Hold the first operation until the others are queued behind it
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := w.Do(func(tx *Tx) error {
+			close(started)
+			<-release
+			return op(tx)
+		})
+		if err != nil {
+			t.Errorf("Do() error = %v", err)
+		}
+	}()
+	<-started
+
+	const queued = 10
+	for i := 0; i < queued; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.Do(op); err != nil {
+				t.Errorf("Do() error = %v", err)
+			}
+		}()
+	}
+	waitFor(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return len(w.queue) == queued
+	})
+
+	close(release)
+	wg.Wait()
+
+	// One push for the first operation, one for the batch queued behind it
+	if backend.pushes != 2 {
+		t.Errorf("Pushes = %d, want 2", backend.pushes)
+	}
+	if len(backend.resets) != 0 {
+		t.Errorf("Resets = %q, want none", backend.resets)
+	}
+}
+
+func TestWorkerResults(t *testing.T) {
+	backend := &fakeBackend{pushErr: errors.New("push rejected")}
+	w := NewWorker(backend)
+
+	// Failed operations return their own error, are rolled back and are not
+	// pushed
+	opErr := errors.New("file exists")
+	if err := w.Do(func(tx *Tx) error { return opErr }); err != opErr {
+		t.Errorf("Do() error = %v, want %v", err, opErr)
+	}
+	if backend.pushes != 0 {
+		t.Errorf("Pushes = %d, want 0", backend.pushes)
+	}
+	if len(backend.resets) != 1 || backend.resets[0] != "abc123" {
+		t.Errorf("Resets = %q, want [abc123]", backend.resets)
+	}
+
+	// Successful operations return the error of their push, and are rolled
+	// back when it fails
+	err := w.Do(func(tx *Tx) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "push rejected") {
+		t.Errorf("Do() error = %v, want push error", err)
+	}
+	if len(backend.resets) != 2 {
+		t.Errorf("Resets = %q, want two", backend.resets)
+	}
+}
+
+// TestConcurrentOperations creates posts from many goroutines at once and
+// checks that every commit holds exactly the files of its own post.
+func TestConcurrentOperations(t *testing.T) {
+	repo, remote := newTestRepo(t, GoGitBackend{})
+
+	const posts = 20
+	ops := &DefaultGitOperations{}
+	var wg sync.WaitGroup
+	for i := 0; i < posts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			content := map[string]interface{}{
+				"type": []interface{}{"h-entry"},
+				"properties": map[string]interface{}{
+					"content":   []interface{}{fmt.Sprintf("Post %d", i)},
+					"mp-slug":   []interface{}{fmt.Sprintf("post-%d", i)},
+					"published": []interface{}{"2024-03-05T10:00:00Z"},
+				},
+			}
+			if err := ops.CreatePost(content); err != nil {
+				t.Errorf("CreatePost() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("Failed to read HEAD: %v", err)
+	}
+	pushed, err := remote.Reference(head.Name(), true)
+	if err != nil {
+		t.Fatalf("Branch %s was not pushed: %v", head.Name(), err)
+	}
+	if pushed.Hash() != head.Hash() {
+		t.Errorf("Remote is at %s, want %s", pushed.Hash(), head.Hash())
+	}
+
+	commits, err := repo.Log(&gogit.LogOptions{From: head.Hash()})
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	count := 0
+	err = commits.ForEach(func(c *object.Commit) error {
+		count++
+		stats, err := c.Stats()
+		if err != nil {
+			return err
+		}
+		if len(stats) != 1 || !strings.HasSuffix(strings.TrimSpace(c.Message), stats[0].Name) {
+			t.Errorf("Commit %q changed %v, want only its own post", strings.TrimSpace(c.Message), stats)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if count != posts {
+		t.Errorf("Commits = %d, want %d", count, posts)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
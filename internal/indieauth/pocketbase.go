@@ -0,0 +1,195 @@
+package indieauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+// Names of the PocketBase collections used by PocketBaseStore.
+const (
+	CodesCollection  = "indieauth_codes"
+	GrantsCollection = "indieauth_grants"
+)
+
+// PocketBaseStore is a Store backed by PocketBase collections. The collections
+// have no API rules, so they are only reachable by PocketBase admins.
+type PocketBaseStore struct {
+	app core.App
+}
+
+// NewPocketBaseStore creates a PocketBaseStore. Call EnsureCollections once the
+// app is bootstrapped and before using the store.
+func NewPocketBaseStore(app core.App) *PocketBaseStore {
+	return &PocketBaseStore{app: app}
+}
+
+// EnsureCollections creates the codes and grants collections if they do not
+// exist, and adds the fields missing from collections created by older versions.
+func (s *PocketBaseStore) EnsureCollections() error {
+	collections := []*models.Collection{
+		{
+			Name: CodesCollection,
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{Name: "code", Type: schema.FieldTypeText, Required: true},
+				&schema.SchemaField{Name: "client_id", Type: schema.FieldTypeText, Required: true},
+				&schema.SchemaField{Name: "redirect_uri", Type: schema.FieldTypeText, Required: true},
+				&schema.SchemaField{Name: "scope", Type: schema.FieldTypeText},
+				&schema.SchemaField{Name: "me", Type: schema.FieldTypeText},
+				&schema.SchemaField{Name: "code_challenge", Type: schema.FieldTypeText},
+				&schema.SchemaField{Name: "user_id", Type: schema.FieldTypeText},
+				&schema.SchemaField{Name: "role", Type: schema.FieldTypeText},
+				&schema.SchemaField{Name: "expires", Type: schema.FieldTypeDate},
+			),
+		},
+		{
+			Name: GrantsCollection,
+			Type: models.CollectionTypeBase,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{Name: "token_hash", Type: schema.FieldTypeText, Required: true},
+				&schema.SchemaField{Name: "client_id", Type: schema.FieldTypeText, Required: true},
+				&schema.SchemaField{Name: "scope", Type: schema.FieldTypeText},
+				&schema.SchemaField{Name: "me", Type: schema.FieldTypeText},
+				&schema.SchemaField{Name: "user_id", Type: schema.FieldTypeText},
+				&schema.SchemaField{Name: "role", Type: schema.FieldTypeText},
+				&schema.SchemaField{Name: "issued", Type: schema.FieldTypeDate},
+				&schema.SchemaField{Name: "expires", Type: schema.FieldTypeDate},
+			),
+		},
+	}
+
+	for _, collection := range collections {
+		existing, err := s.app.Dao().FindCollectionByNameOrId(collection.Name)
+		if err != nil {
+			if err := s.app.Dao().SaveCollection(collection); err != nil {
+				return fmt.Errorf("failed to create %s collection: %w", collection.Name, err)
+			}
+			continue
+		}
+
+		missing := false
+		for _, field := range collection.Schema.Fields() {
+			if existing.Schema.GetFieldByName(field.Name) == nil {
+				existing.Schema.AddField(field)
+				missing = true
+			}
+		}
+		if !missing {
+			continue
+		}
+		if err := s.app.Dao().SaveCollection(existing); err != nil {
+			return fmt.Errorf("failed to update %s collection: %w", collection.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *PocketBaseStore) SaveCode(ctx context.Context, code *AuthCode) error {
+	collection, err := s.app.Dao().FindCollectionByNameOrId(CodesCollection)
+	if err != nil {
+		return err
+	}
+
+	record := models.NewRecord(collection)
+	record.Set("code", code.Code)
+	record.Set("client_id", code.ClientID)
+	record.Set("redirect_uri", code.RedirectURI)
+	record.Set("scope", code.Scope)
+	record.Set("me", code.Me)
+	record.Set("code_challenge", code.CodeChallenge)
+	record.Set("user_id", code.UserID)
+	record.Set("role", code.Role)
+	record.Set("expires", code.ExpiresAt)
+
+	return s.app.Dao().SaveRecord(record)
+}
+
+func (s *PocketBaseStore) TakeCode(ctx context.Context, code string) (*AuthCode, error) {
+	record, err := s.findRecord(CodesCollection, "code", code)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.app.Dao().DeleteRecord(record); err != nil {
+		return nil, err
+	}
+
+	return &AuthCode{
+		Code:          record.GetString("code"),
+		ClientID:      record.GetString("client_id"),
+		RedirectURI:   record.GetString("redirect_uri"),
+		Scope:         record.GetString("scope"),
+		Me:            record.GetString("me"),
+		CodeChallenge: record.GetString("code_challenge"),
+		UserID:        record.GetString("user_id"),
+		Role:          record.GetString("role"),
+		ExpiresAt:     record.GetTime("expires"),
+	}, nil
+}
+
+func (s *PocketBaseStore) SaveGrant(ctx context.Context, grant *Grant) error {
+	collection, err := s.app.Dao().FindCollectionByNameOrId(GrantsCollection)
+	if err != nil {
+		return err
+	}
+
+	record := models.NewRecord(collection)
+	record.Set("token_hash", grant.TokenHash)
+	record.Set("client_id", grant.ClientID)
+	record.Set("scope", grant.Scope)
+	record.Set("me", grant.Me)
+	record.Set("user_id", grant.UserID)
+	record.Set("role", grant.Role)
+	record.Set("issued", grant.IssuedAt)
+	if !grant.ExpiresAt.IsZero() {
+		record.Set("expires", grant.ExpiresAt)
+	}
+
+	return s.app.Dao().SaveRecord(record)
+}
+
+func (s *PocketBaseStore) FindGrant(ctx context.Context, tokenHash string) (*Grant, error) {
+	record, err := s.findRecord(GrantsCollection, "token_hash", tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Grant{
+		TokenHash: record.GetString("token_hash"),
+		ClientID:  record.GetString("client_id"),
+		Scope:     record.GetString("scope"),
+		Me:        record.GetString("me"),
+		UserID:    record.GetString("user_id"),
+		Role:      record.GetString("role"),
+		IssuedAt:  record.GetTime("issued"),
+		ExpiresAt: record.GetTime("expires"),
+	}, nil
+}
+
+func (s *PocketBaseStore) DeleteGrant(ctx context.Context, tokenHash string) error {
+	record, err := s.findRecord(GrantsCollection, "token_hash", tokenHash)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.app.Dao().DeleteRecord(record)
+}
+
+func (s *PocketBaseStore) findRecord(collection, key, value string) (*models.Record, error) {
+	record, err := s.app.Dao().FindFirstRecordByData(collection, key, value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return record, err
+}
+
+// ensure PocketBaseStore satisfies Store
+var _ Store = (*PocketBaseStore)(nil)
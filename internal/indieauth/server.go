@@ -0,0 +1,530 @@
+package indieauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v5"
+)
+
+// SupportedScopes lists the scopes the authorization endpoint can grant.
+var SupportedScopes = []string{"create", "update", "delete", "media", "draft", "profile"}
+
+// DefaultCodeLifetime is how long an authorization code can be redeemed.
+const DefaultCodeLifetime = 10 * time.Minute
+
+// Authenticator returns the ID of the user logged in to the server, if any.
+type Authenticator func(c echo.Context) (userID string, ok bool)
+
+// Server implements the IndieAuth authorization and token endpoints, including
+// PKCE, a consent screen, token introspection and revocation.
+type Server struct {
+	// Issuer is the public base URL of the server, e.g. "https://example.com".
+	Issuer string
+	// Me is the profile URL of the site owner returned to clients.
+	Me string
+	// Store persists authorization codes and grants.
+	Store Store
+	// Authenticate reports the logged-in user approving requests.
+	Authenticate Authenticator
+	// UserRole returns the role of a user. Only users with one of
+	// ApproverRoles may approve requests, and their role is recorded on the
+	// tokens issued to them. When UserRole is nil, nobody may approve requests.
+	UserRole func(userID string) string
+	// ApproverRoles lists the roles allowed to approve requests.
+	ApproverRoles []string
+	// ConsentTemplate renders the consent screen.
+	ConsentTemplate *template.Template
+	// LoginURL is where users that are not logged in are sent.
+	LoginURL string
+	// CodeLifetime is how long authorization codes remain valid.
+	CodeLifetime time.Duration
+	// TokenLifetime is how long access tokens remain valid; zero means forever.
+	TokenLifetime time.Duration
+
+	now func() time.Time
+}
+
+// NewServer creates a Server with default lifetimes and login URL.
+func NewServer(issuer, me string, store Store, authenticate Authenticator, consent *template.Template) *Server {
+	return &Server{
+		Issuer:          strings.TrimRight(issuer, "/"),
+		Me:              me,
+		Store:           store,
+		Authenticate:    authenticate,
+		ConsentTemplate: consent,
+		LoginURL:        "/login",
+		CodeLifetime:    DefaultCodeLifetime,
+		now:             time.Now,
+	}
+}
+
+// Register adds the IndieAuth routes to e.
+func (s *Server) Register(e *echo.Echo) {
+	e.GET("/.well-known/oauth-authorization-server", s.HandleMetadata)
+	e.GET("/auth", s.HandleAuthorize)
+	e.POST("/auth", s.HandleProfile)
+	e.POST("/auth/consent", s.HandleConsent)
+	e.GET("/token", s.HandleTokenVerification)
+	e.POST("/token", s.HandleToken)
+	e.POST("/token/introspect", s.HandleIntrospect)
+	e.POST("/token/revoke", s.HandleRevoke)
+}
+
+// HandleMetadata serves the IndieAuth server metadata document.
+func (s *Server) HandleMetadata(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"issuer":                                         s.Issuer + "/",
+		"authorization_endpoint":                         s.Issuer + "/auth",
+		"token_endpoint":                                 s.Issuer + "/token",
+		"introspection_endpoint":                         s.Issuer + "/token/introspect",
+		"revocation_endpoint":                            s.Issuer + "/token/revoke",
+		"scopes_supported":                               SupportedScopes,
+		"response_types_supported":                       []string{"code"},
+		"grant_types_supported":                          []string{"authorization_code"},
+		"code_challenge_methods_supported":               []string{"S256"},
+		"authorization_response_iss_parameter_supported": true,
+	})
+}
+
+// authRequest holds the parameters of an authorization request.
+type authRequest struct {
+	ClientID            string
+	RedirectURI         string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Scope               string
+	Me                  string
+}
+
+// Scopes returns the requested scopes as a slice.
+func (r *authRequest) Scopes() []string {
+	return strings.Fields(r.Scope)
+}
+
+func parseAuthRequest(values url.Values) *authRequest {
+	return &authRequest{
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Scope:               values.Get("scope"),
+		Me:                  values.Get("me"),
+	}
+}
+
+// validateClient checks client_id and redirect_uri. Errors found here must not
+// be reported by redirecting, since the redirect URI cannot be trusted.
+func (r *authRequest) validateClient() error {
+	client, err := url.Parse(r.ClientID)
+	if err != nil || (client.Scheme != "https" && client.Scheme != "http") || client.Host == "" {
+		return errors.New("client_id must be an http or https URL")
+	}
+	redirect, err := url.Parse(r.RedirectURI)
+	if err != nil || (redirect.Scheme != "https" && redirect.Scheme != "http") || redirect.Host == "" {
+		return errors.New("redirect_uri must be an http or https URL")
+	}
+	if !strings.EqualFold(client.Scheme, redirect.Scheme) || !strings.EqualFold(client.Host, redirect.Host) {
+		return errors.New("redirect_uri must be on the same host as client_id")
+	}
+	return nil
+}
+
+// validate checks the remaining parameters once the client is known to be valid.
+func (r *authRequest) validate() error {
+	if r.State == "" {
+		return errors.New("state is required")
+	}
+	if r.CodeChallenge == "" {
+		return errors.New("code_challenge is required")
+	}
+	if r.CodeChallengeMethod != "S256" {
+		return errors.New("code_challenge_method must be S256")
+	}
+	return nil
+}
+
+// HandleAuthorize validates an authorization request and shows the consent screen.
+func (s *Server) HandleAuthorize(c echo.Context) error {
+	query := c.QueryParams()
+	req := parseAuthRequest(query)
+
+	if err := req.validateClient(); err != nil {
+		return oauthError(c, http.StatusBadRequest, "invalid_request", err.Error())
+	}
+	if responseType := query.Get("response_type"); responseType != "" && responseType != "code" {
+		return redirectError(c, req, "unsupported_response_type", "response_type must be code")
+	}
+	if err := req.validate(); err != nil {
+		return redirectError(c, req, "invalid_request", err.Error())
+	}
+
+	userID, ok := s.Authenticate(c)
+	if !ok {
+		return c.Redirect(http.StatusFound, s.LoginURL+"?next="+url.QueryEscape(c.Request().URL.RequestURI()))
+	}
+	if _, ok := s.approverRole(userID); !ok {
+		return oauthError(c, http.StatusForbidden, "access_denied", "you are not allowed to approve requests")
+	}
+
+	return s.renderConsent(c, req)
+}
+
+// approverRole returns the role of a user and whether it allows them to
+// approve requests.
+func (s *Server) approverRole(userID string) (string, bool) {
+	if s.UserRole == nil {
+		return "", false
+	}
+	role := s.UserRole(userID)
+	return role, role != "" && containsString(s.ApproverRoles, role)
+}
+
+func (s *Server) renderConsent(c echo.Context, req *authRequest) error {
+	if s.ConsentTemplate == nil {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "consent screen is not configured")
+	}
+
+	var buf bytes.Buffer
+	err := s.ConsentTemplate.Execute(&buf, map[string]interface{}{
+		"ClientID":            req.ClientID,
+		"RedirectURI":         req.RedirectURI,
+		"State":               req.State,
+		"CodeChallenge":       req.CodeChallenge,
+		"CodeChallengeMethod": req.CodeChallengeMethod,
+		"Scope":               req.Scope,
+		"Scopes":              req.Scopes(),
+		"Me":                  s.Me,
+	})
+	if err != nil {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "failed to render consent screen")
+	}
+
+	return c.HTML(http.StatusOK, buf.String())
+}
+
+// HandleConsent processes the consent form and redirects back to the client
+// with an authorization code.
+func (s *Server) HandleConsent(c echo.Context) error {
+	userID, ok := s.Authenticate(c)
+	if !ok {
+		return oauthError(c, http.StatusUnauthorized, "access_denied", "you must be logged in to approve requests")
+	}
+	role, ok := s.approverRole(userID)
+	if !ok {
+		return oauthError(c, http.StatusForbidden, "access_denied", "you are not allowed to approve requests")
+	}
+
+	form, err := c.FormValues()
+	if err != nil {
+		return oauthError(c, http.StatusBadRequest, "invalid_request", "failed to parse consent form")
+	}
+
+	req := parseAuthRequest(form)
+	req.Scope = form.Get("requested_scope")
+	if err := req.validateClient(); err != nil {
+		return oauthError(c, http.StatusBadRequest, "invalid_request", err.Error())
+	}
+	if err := req.validate(); err != nil {
+		return redirectError(c, req, "invalid_request", err.Error())
+	}
+
+	if form.Get("decision") != "approve" {
+		return redirectError(c, req, "access_denied", "the user denied the request")
+	}
+
+	// Only grant scopes that were both requested and left checked by the user
+	var granted []string
+	for _, scope := range form["scope"] {
+		if containsString(req.Scopes(), scope) && containsString(SupportedScopes, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	code := &AuthCode{
+		Code:          randomToken(),
+		ClientID:      req.ClientID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(granted, " "),
+		Me:            s.Me,
+		CodeChallenge: req.CodeChallenge,
+		UserID:        userID,
+		Role:          role,
+		ExpiresAt:     s.now().Add(s.CodeLifetime),
+	}
+	if err := s.Store.SaveCode(c.Request().Context(), code); err != nil {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "failed to store authorization code")
+	}
+
+	return c.Redirect(http.StatusFound, redirectURL(req.RedirectURI, url.Values{
+		"code":  {code.Code},
+		"state": {req.State},
+		"iss":   {s.Issuer + "/"},
+	}))
+}
+
+// redeemCode takes the authorization code from a token or profile request and
+// checks it against the client, redirect URI and PKCE verifier.
+func (s *Server) redeemCode(ctx context.Context, form url.Values) (*AuthCode, error) {
+	if grantType := form.Get("grant_type"); grantType != "" && grantType != "authorization_code" {
+		return nil, errors.New("unsupported grant_type")
+	}
+
+	code, err := s.Store.TakeCode(ctx, form.Get("code"))
+	if err != nil {
+		return nil, errors.New("authorization code is invalid")
+	}
+	if s.now().After(code.ExpiresAt) {
+		return nil, errors.New("authorization code has expired")
+	}
+	if code.ClientID != form.Get("client_id") || code.RedirectURI != form.Get("redirect_uri") {
+		return nil, errors.New("client_id or redirect_uri does not match the authorization request")
+	}
+	if !verifyChallenge(code.CodeChallenge, form.Get("code_verifier")) {
+		return nil, errors.New("code_verifier does not match the code_challenge")
+	}
+
+	return code, nil
+}
+
+// HandleProfile redeems an authorization code for the user's profile URL only.
+func (s *Server) HandleProfile(c echo.Context) error {
+	form, err := c.FormValues()
+	if err != nil {
+		return oauthError(c, http.StatusBadRequest, "invalid_request", "failed to parse request")
+	}
+
+	code, err := s.redeemCode(c.Request().Context(), form)
+	if err != nil {
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", err.Error())
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, map[string]string{"me": code.Me})
+}
+
+// HandleToken redeems an authorization code for an access token. It also
+// accepts the legacy action=revoke form of token revocation.
+func (s *Server) HandleToken(c echo.Context) error {
+	form, err := c.FormValues()
+	if err != nil {
+		return oauthError(c, http.StatusBadRequest, "invalid_request", "failed to parse request")
+	}
+
+	if form.Get("action") == "revoke" {
+		return s.revoke(c, form.Get("token"))
+	}
+
+	if form.Get("grant_type") != "authorization_code" {
+		return oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code")
+	}
+
+	code, err := s.redeemCode(c.Request().Context(), form)
+	if err != nil {
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", err.Error())
+	}
+	if code.Scope == "" {
+		return oauthError(c, http.StatusBadRequest, "invalid_grant", "no scopes were granted, use the authorization endpoint to verify identity")
+	}
+
+	accessToken := randomToken()
+	grant := &Grant{
+		TokenHash: hashToken(accessToken),
+		ClientID:  code.ClientID,
+		Scope:     code.Scope,
+		Me:        code.Me,
+		UserID:    code.UserID,
+		Role:      code.Role,
+		IssuedAt:  s.now(),
+	}
+	if s.TokenLifetime > 0 {
+		grant.ExpiresAt = grant.IssuedAt.Add(s.TokenLifetime)
+	}
+	if err := s.Store.SaveGrant(c.Request().Context(), grant); err != nil {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "failed to store access token")
+	}
+
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"scope":        grant.Scope,
+		"me":           grant.Me,
+	}
+	if s.TokenLifetime > 0 {
+		response["expires_in"] = int(s.TokenLifetime.Seconds())
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, response)
+}
+
+// HandleTokenVerification implements the legacy GET token verification used by
+// EndpointVerifier.
+func (s *Server) HandleTokenVerification(c echo.Context) error {
+	token, err := s.Verify(c.Request().Context(), BearerToken(c.Request()))
+	if err != nil {
+		return oauthError(c, http.StatusUnauthorized, "invalid_token", "the access token is invalid or has expired")
+	}
+	return c.JSON(http.StatusOK, token)
+}
+
+// HandleIntrospect implements token introspection. Callers must be logged in
+// or present a valid access token of their own.
+func (s *Server) HandleIntrospect(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if _, ok := s.Authenticate(c); !ok {
+		if _, err := s.Verify(ctx, BearerToken(c.Request())); err != nil {
+			return oauthError(c, http.StatusUnauthorized, "invalid_client", "introspection requires authorization")
+		}
+	}
+
+	form, err := c.FormValues()
+	if err != nil {
+		return oauthError(c, http.StatusBadRequest, "invalid_request", "failed to parse request")
+	}
+
+	grant, err := s.Store.FindGrant(ctx, hashToken(form.Get("token")))
+	if err != nil || grant.Expired(s.now()) {
+		return c.JSON(http.StatusOK, map[string]bool{"active": false})
+	}
+	if _, ok := s.approverRole(grant.UserID); !ok {
+		return c.JSON(http.StatusOK, map[string]bool{"active": false})
+	}
+
+	response := map[string]interface{}{
+		"active":    true,
+		"me":        grant.Me,
+		"client_id": grant.ClientID,
+		"scope":     grant.Scope,
+		"iat":       grant.IssuedAt.Unix(),
+	}
+	if !grant.ExpiresAt.IsZero() {
+		response["exp"] = grant.ExpiresAt.Unix()
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// HandleRevoke revokes an access token. Unknown tokens are ignored.
+func (s *Server) HandleRevoke(c echo.Context) error {
+	form, err := c.FormValues()
+	if err != nil {
+		return oauthError(c, http.StatusBadRequest, "invalid_request", "failed to parse request")
+	}
+	return s.revoke(c, form.Get("token"))
+}
+
+func (s *Server) revoke(c echo.Context, token string) error {
+	if token == "" {
+		return oauthError(c, http.StatusBadRequest, "invalid_request", "token is required")
+	}
+	if err := s.Store.DeleteGrant(c.Request().Context(), hashToken(token)); err != nil {
+		return oauthError(c, http.StatusInternalServerError, "server_error", "failed to revoke token")
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// Verify implements Verifier using the tokens issued by this server.
+func (s *Server) Verify(ctx context.Context, token string) (*Token, error) {
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+
+	grant, err := s.Store.FindGrant(ctx, hashToken(token))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if grant.Expired(s.now()) {
+		return nil, ErrInvalidToken
+	}
+
+	// The current role of the user counts, not the one they had when the
+	// token was issued, so tokens of demoted or deleted users stop working
+	role, ok := s.approverRole(grant.UserID)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return &Token{Me: grant.Me, ClientID: grant.ClientID, Scope: grant.Scope, Role: role}, nil
+}
+
+// verifyChallenge checks a PKCE code_verifier against an S256 code_challenge.
+func verifyChallenge(challenge, verifier string) bool {
+	if challenge == "" || verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("indieauth: failed to read random bytes: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func redirectURL(base string, params url.Values) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func redirectError(c echo.Context, req *authRequest, code, description string) error {
+	params := url.Values{
+		"error":             {code},
+		"error_description": {description},
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return c.Redirect(http.StatusFound, redirectURL(req.RedirectURI, params))
+}
+
+func oauthError(c echo.Context, status int, code, description string) error {
+	return c.JSON(status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
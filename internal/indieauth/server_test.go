@@ -0,0 +1,330 @@
+package indieauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	testClientID    = "https://app.example/"
+	testRedirectURI = "https://app.example/callback"
+	testVerifier    = "a-very-long-code-verifier-used-only-for-these-tests"
+)
+
+func testChallenge() string {
+	sum := sha256.Sum256([]byte(testVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func newTestServer(loggedIn bool) (*Server, *echo.Echo) {
+	return newTestServerWithRole(loggedIn, "editor")
+}
+
+// newTestServerWithRole creates a server where the logged-in user has role.
+func newTestServerWithRole(loggedIn bool, role string) (*Server, *echo.Echo) {
+	authenticate := func(c echo.Context) (string, bool) {
+		return "user1", loggedIn
+	}
+	consent := template.Must(template.New("consent").Parse(`{{.ClientID}} {{.Scope}}`))
+	server := NewServer("https://example.com/", "https://example.com/", NewMemoryStore(), authenticate, consent)
+	server.UserRole = func(userID string) string {
+		return role
+	}
+	server.ApproverRoles = []string{"admin", "editor"}
+
+	e := echo.New()
+	server.Register(e)
+	return server, e
+}
+
+func serve(e *echo.Echo, method, target string, form url.Values, header http.Header) *httptest.ResponseRecorder {
+	var body *strings.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+	req := httptest.NewRequest(method, target, body)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func consentForm(decision string, scopes ...string) url.Values {
+	return url.Values{
+		"client_id":             {testClientID},
+		"redirect_uri":          {testRedirectURI},
+		"state":                 {"xyz"},
+		"code_challenge":        {testChallenge()},
+		"code_challenge_method": {"S256"},
+		"requested_scope":       {"create update"},
+		"scope":                 scopes,
+		"decision":              {decision},
+	}
+}
+
+// authorize approves a consent form and returns the issued authorization code.
+func authorize(t *testing.T, e *echo.Echo, scopes ...string) string {
+	t.Helper()
+	rec := serve(e, http.MethodPost, "/auth/consent", consentForm("approve", scopes...), nil)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("consent status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect: %v", err)
+	}
+	if location.Query().Get("state") != "xyz" || location.Query().Get("iss") != "https://example.com/" {
+		t.Errorf("unexpected redirect %s", location)
+	}
+	return location.Query().Get("code")
+}
+
+func tokenForm(code string) url.Values {
+	return url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {testClientID},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testVerifier},
+	}
+}
+
+func TestServerAuthorize(t *testing.T) {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {testClientID},
+		"redirect_uri":          {testRedirectURI},
+		"state":                 {"xyz"},
+		"code_challenge":        {testChallenge()},
+		"code_challenge_method": {"S256"},
+		"scope":                 {"create update"},
+	}
+
+	t.Run("Consent", func(t *testing.T) {
+		_, e := newTestServer(true)
+		rec := serve(e, http.MethodGet, "/auth?"+query.Encode(), nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		if rec.Body.String() != testClientID+" create update" {
+			t.Errorf("unexpected consent page %q", rec.Body.String())
+		}
+	})
+
+	t.Run("LoginRequired", func(t *testing.T) {
+		_, e := newTestServer(false)
+		rec := serve(e, http.MethodGet, "/auth?"+query.Encode(), nil, nil)
+		if rec.Code != http.StatusFound || !strings.HasPrefix(rec.Header().Get("Location"), "/login?next=%2Fauth%3F") {
+			t.Errorf("status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+		}
+	})
+
+	t.Run("RedirectOnOtherHost", func(t *testing.T) {
+		_, e := newTestServer(true)
+		bad := url.Values{}
+		for key, values := range query {
+			bad[key] = values
+		}
+		bad.Set("redirect_uri", "https://evil.example/callback")
+		rec := serve(e, http.MethodGet, "/auth?"+bad.Encode(), nil, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("MissingPKCE", func(t *testing.T) {
+		_, e := newTestServer(true)
+		bad := url.Values{}
+		for key, values := range query {
+			bad[key] = values
+		}
+		bad.Del("code_challenge")
+		rec := serve(e, http.MethodGet, "/auth?"+bad.Encode(), nil, nil)
+		location := rec.Header().Get("Location")
+		if rec.Code != http.StatusFound || !strings.HasPrefix(location, testRedirectURI) || !strings.Contains(location, "error=invalid_request") {
+			t.Errorf("status = %d, location = %q", rec.Code, location)
+		}
+	})
+
+	t.Run("Denied", func(t *testing.T) {
+		_, e := newTestServer(true)
+		rec := serve(e, http.MethodPost, "/auth/consent", consentForm("deny"), nil)
+		if !strings.Contains(rec.Header().Get("Location"), "error=access_denied") {
+			t.Errorf("location = %q", rec.Header().Get("Location"))
+		}
+	})
+
+	// Users who signed up but were not given a role cannot approve requests
+	t.Run("RoleRequired", func(t *testing.T) {
+		_, e := newTestServerWithRole(true, "user")
+		rec := serve(e, http.MethodGet, "/auth?"+query.Encode(), nil, nil)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+		}
+		rec = serve(e, http.MethodPost, "/auth/consent", consentForm("approve", "create"), nil)
+		if rec.Code != http.StatusForbidden || rec.Header().Get("Location") != "" {
+			t.Errorf("consent status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+		}
+	})
+}
+
+func TestServerToken(t *testing.T) {
+	server, e := newTestServer(true)
+
+	// Only scopes that were requested are granted
+	code := authorize(t, e, "create", "delete")
+	rec := serve(e, http.MethodPost, "/token", tokenForm(code), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("token status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		Scope       string `json:"scope"`
+		Me          string `json:"me"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode token response: %v", err)
+	}
+	if response.TokenType != "Bearer" || response.Scope != "create" || response.Me != "https://example.com/" {
+		t.Errorf("unexpected token response %+v", response)
+	}
+
+	token, err := server.Verify(context.Background(), response.AccessToken)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if token.ClientID != testClientID || !token.HasScope("create") || token.Role != "editor" {
+		t.Errorf("Verify() token = %+v", token)
+	}
+
+	t.Run("CodeReused", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "/token", tokenForm(code), nil)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_grant") {
+			t.Errorf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("WrongVerifier", func(t *testing.T) {
+		form := tokenForm(authorize(t, e, "create"))
+		form.Set("code_verifier", "wrong")
+		rec := serve(e, http.MethodPost, "/token", form, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("NoScope", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "/token", tokenForm(authorize(t, e)), nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("Profile", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "/auth", tokenForm(authorize(t, e)), nil)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"me":"https://example.com/"`) {
+			t.Errorf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("Verification", func(t *testing.T) {
+		rec := serve(e, http.MethodGet, "/token", nil, http.Header{"Authorization": {"Bearer " + response.AccessToken}})
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), testClientID) {
+			t.Errorf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("Introspect", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "/token/introspect", url.Values{"token": {response.AccessToken}}, nil)
+		if !strings.Contains(rec.Body.String(), `"active":true`) {
+			t.Errorf("body = %s", rec.Body.String())
+		}
+	})
+
+	// Tokens follow the current role of their user
+	t.Run("Demoted", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "/token", tokenForm(authorize(t, e, "create")), nil)
+		var issued struct {
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &issued); err != nil {
+			t.Fatalf("failed to decode token response: %v", err)
+		}
+
+		userRole := server.UserRole
+		defer func() { server.UserRole = userRole }()
+		for _, role := range []string{"user", ""} {
+			server.UserRole = func(userID string) string { return role }
+			if _, err := server.Verify(context.Background(), issued.AccessToken); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify() with role %q error = %v, want ErrInvalidToken", role, err)
+			}
+			rec := serve(e, http.MethodPost, "/token/introspect", url.Values{"token": {issued.AccessToken}}, http.Header{"Authorization": {"Bearer " + response.AccessToken}})
+			if !strings.Contains(rec.Body.String(), `"active":false`) {
+				t.Errorf("introspection with role %q body = %s", role, rec.Body.String())
+			}
+		}
+
+		server.UserRole = func(userID string) string { return "admin" }
+		if token, err := server.Verify(context.Background(), issued.AccessToken); err != nil || token.Role != "admin" {
+			t.Errorf("Verify() after promotion = %+v, %v", token, err)
+		}
+	})
+
+	// Scopes the server does not know are not granted, even when requested
+	t.Run("UnsupportedScope", func(t *testing.T) {
+		form := consentForm("approve", "create", "admin")
+		form.Set("requested_scope", "create admin")
+		rec := serve(e, http.MethodPost, "/auth/consent", form, nil)
+		location, err := url.Parse(rec.Header().Get("Location"))
+		if rec.Code != http.StatusFound || err != nil {
+			t.Fatalf("consent status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+		}
+		rec = serve(e, http.MethodPost, "/token", tokenForm(location.Query().Get("code")), nil)
+		if !strings.Contains(rec.Body.String(), `"scope":"create"`) {
+			t.Errorf("token body = %s", rec.Body.String())
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "/token/revoke", url.Values{"token": {response.AccessToken}}, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d", rec.Code)
+		}
+		if _, err := server.Verify(context.Background(), response.AccessToken); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify() after revoke error = %v, want ErrInvalidToken", err)
+		}
+
+		rec = serve(e, http.MethodPost, "/token/introspect", url.Values{"token": {response.AccessToken}}, nil)
+		if !strings.Contains(rec.Body.String(), `"active":false`) {
+			t.Errorf("body = %s", rec.Body.String())
+		}
+	})
+}
+
+func TestServerIntrospectRequiresAuthorization(t *testing.T) {
+	_, e := newTestServer(false)
+	rec := serve(e, http.MethodPost, "/token/introspect", url.Values{"token": {"anything"}}, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,113 @@
+package indieauth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Store when a code or grant does not exist.
+var ErrNotFound = errors.New("not found")
+
+// AuthCode is an authorization code issued by the authorization endpoint and
+// redeemed at the token endpoint.
+type AuthCode struct {
+	Code          string
+	ClientID      string
+	RedirectURI   string
+	Scope         string
+	Me            string
+	CodeChallenge string
+	UserID        string
+	// Role is the role of the user who approved the request.
+	Role      string
+	ExpiresAt time.Time
+}
+
+// Grant is an issued access token. Only the SHA-256 hash of the token is stored.
+type Grant struct {
+	TokenHash string
+	ClientID  string
+	Scope     string
+	Me        string
+	UserID    string
+	// Role is the role the user had when the token was issued. Verify
+	// uses their current role instead.
+	Role     string
+	IssuedAt time.Time
+	// ExpiresAt is zero for tokens that do not expire.
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the grant has expired at t.
+func (g *Grant) Expired(t time.Time) bool {
+	return !g.ExpiresAt.IsZero() && t.After(g.ExpiresAt)
+}
+
+// Store persists authorization codes and grants.
+type Store interface {
+	SaveCode(ctx context.Context, code *AuthCode) error
+	// TakeCode returns and removes a code so it can only be redeemed once.
+	TakeCode(ctx context.Context, code string) (*AuthCode, error)
+	SaveGrant(ctx context.Context, grant *Grant) error
+	FindGrant(ctx context.Context, tokenHash string) (*Grant, error)
+	DeleteGrant(ctx context.Context, tokenHash string) error
+}
+
+// MemoryStore is a Store that keeps codes and grants in memory.
+type MemoryStore struct {
+	mu     sync.Mutex
+	codes  map[string]AuthCode
+	grants map[string]Grant
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		codes:  make(map[string]AuthCode),
+		grants: make(map[string]Grant),
+	}
+}
+
+func (s *MemoryStore) SaveCode(ctx context.Context, code *AuthCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[code.Code] = *code
+	return nil
+}
+
+func (s *MemoryStore) TakeCode(ctx context.Context, code string) (*AuthCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.codes[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(s.codes, code)
+	return &c, nil
+}
+
+func (s *MemoryStore) SaveGrant(ctx context.Context, grant *Grant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.grants[grant.TokenHash] = *grant
+	return nil
+}
+
+func (s *MemoryStore) FindGrant(ctx context.Context, tokenHash string) (*Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.grants[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &g, nil
+}
+
+func (s *MemoryStore) DeleteGrant(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.grants, tokenHash)
+	return nil
+}
@@ -0,0 +1,176 @@
+// Package indieauth verifies IndieAuth access tokens presented to the Micropub endpoint.
+package indieauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned when an access token is unknown, expired or
+// was issued for a different site.
+var ErrInvalidToken = errors.New("invalid access token")
+
+// Token describes a verified access token.
+type Token struct {
+	// Me is the URL of the user the token was issued to.
+	Me string `json:"me"`
+	// ClientID is the URL of the client application the token was issued to.
+	ClientID string `json:"client_id"`
+	// Scope is the space-separated list of granted scopes.
+	Scope string `json:"scope"`
+	// Role is the current role of the user who approved the token. It is
+	// only set for tokens issued by Server and is never taken from a remote
+	// endpoint.
+	Role string `json:"-"`
+}
+
+// Scopes returns the granted scopes as a slice.
+func (t *Token) Scopes() []string {
+	return strings.Fields(t.Scope)
+}
+
+// HasScope reports whether the token was granted scope.
+func (t *Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier verifies access tokens.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*Token, error)
+}
+
+// EndpointVerifier verifies tokens against a remote IndieAuth token endpoint.
+type EndpointVerifier struct {
+	// Endpoint is the URL of the token endpoint.
+	Endpoint string
+	// Me is the URL of the site owner. Only tokens issued for this URL are
+	// accepted; when empty, every token is rejected.
+	Me string
+	// Client is the HTTP client used to reach the endpoint.
+	Client *http.Client
+}
+
+// NewEndpointVerifier creates an EndpointVerifier for the given token endpoint.
+func NewEndpointVerifier(endpoint, me string) *EndpointVerifier {
+	return &EndpointVerifier{
+		Endpoint: endpoint,
+		Me:       me,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Verify asks the token endpoint about token and returns the token details.
+func (v *EndpointVerifier) Verify(ctx context.Context, token string) (*Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.Endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token verification request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, ErrInvalidToken
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	result, err := decodeTokenResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Me == "" || v.Me == "" || !SameURL(result.Me, v.Me) {
+		return nil, ErrInvalidToken
+	}
+
+	return result, nil
+}
+
+// decodeTokenResponse reads a token verification response, which older
+// endpoints send form-encoded rather than as JSON.
+func decodeTokenResponse(resp *http.Response) (*Token, error) {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	if mediaType == "application/x-www-form-urlencoded" {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token response: %w", err)
+		}
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode token response: %w", err)
+		}
+		return &Token{
+			Me:       values.Get("me"),
+			ClientID: values.Get("client_id"),
+			Scope:    values.Get("scope"),
+		}, nil
+	}
+
+	var token Token
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	return &token, nil
+}
+
+// SameURL reports whether two profile URLs identify the same user, ignoring
+// case in the host and a trailing slash.
+func SameURL(a, b string) bool {
+	return normalizeURL(a) == normalizeURL(b)
+}
+
+func normalizeURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// BearerToken returns the access token sent in the Authorization header or,
+// for form-encoded requests, the access_token form field.
+func BearerToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			return strings.TrimSpace(auth[7:])
+		}
+		return ""
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data" {
+		return r.PostFormValue("access_token")
+	}
+	return ""
+}
@@ -0,0 +1,129 @@
+package indieauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTokenEndpoint(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer good":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"me":"https://example.com/","client_id":"https://quill.p3k.io/","scope":"create update"}`))
+		case "Bearer form":
+			w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+			w.Write([]byte("me=https%3A%2F%2Fexample.com%2F&client_id=https%3A%2F%2Findigenous.realize.be&scope=create"))
+		case "Bearer other-site":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"me":"https://someone-else.example/","client_id":"https://quill.p3k.io/","scope":"create"}`))
+		case "Bearer broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+}
+
+func TestEndpointVerifier(t *testing.T) {
+	server := newTokenEndpoint(t)
+	defer server.Close()
+
+	verifier := NewEndpointVerifier(server.URL, "https://Example.com")
+
+	t.Run("ValidJSON", func(t *testing.T) {
+		token, err := verifier.Verify(context.Background(), "good")
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if token.ClientID != "https://quill.p3k.io/" {
+			t.Errorf("Verify() client_id = %q", token.ClientID)
+		}
+		if !token.HasScope("create") || !token.HasScope("update") || token.HasScope("delete") {
+			t.Errorf("Verify() scopes = %v", token.Scopes())
+		}
+	})
+
+	t.Run("ValidForm", func(t *testing.T) {
+		token, err := verifier.Verify(context.Background(), "form")
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if token.Me != "https://example.com/" || token.ClientID != "https://indigenous.realize.be" {
+			t.Errorf("Verify() token = %+v", token)
+		}
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		if _, err := verifier.Verify(context.Background(), "bad"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+		}
+	})
+
+	t.Run("OtherSite", func(t *testing.T) {
+		if _, err := verifier.Verify(context.Background(), "other-site"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+		}
+	})
+
+	t.Run("NoSiteOwner", func(t *testing.T) {
+		verifier := NewEndpointVerifier(server.URL, "")
+		if _, err := verifier.Verify(context.Background(), "good"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+		}
+	})
+
+	t.Run("EndpointFailure", func(t *testing.T) {
+		_, err := verifier.Verify(context.Background(), "broken")
+		if err == nil || errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify() error = %v, want endpoint failure", err)
+		}
+	})
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"Header", "Bearer abc123", "", "", "abc123"},
+		{"LowercaseScheme", "bearer abc123", "", "", "abc123"},
+		{"OtherScheme", "Basic dXNlcjpwYXNz", "", "", ""},
+		{"FormField", "", "application/x-www-form-urlencoded", "h=entry&access_token=xyz", "xyz"},
+		{"JSONBody", "", "application/json", `{"access_token":"xyz"}`, ""},
+		{"None", "", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(tt.body))
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			if got := BearerToken(req); got != tt.want {
+				t.Errorf("BearerToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameURL(t *testing.T) {
+	if !SameURL("https://Example.com", "https://example.com/") {
+		t.Errorf("SameURL() should ignore host case and trailing slash")
+	}
+	if SameURL("https://example.com/", "https://example.org/") {
+		t.Errorf("SameURL() matched different hosts")
+	}
+}
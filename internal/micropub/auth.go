@@ -0,0 +1,140 @@
+package micropub
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/harperreed/micropub-service/internal/git"
+	"github.com/harperreed/micropub-service/internal/indieauth"
+	"github.com/labstack/echo/v5"
+)
+
+// tokenContextKey is the echo context key holding the verified *indieauth.Token.
+const tokenContextKey = "indieauth_token"
+
+// TokenAuthorization verifies the bearer token sent with a request and stores
+// it in the context for TokenFromContext. Requests without a token are passed
+// on unchanged so that session-based authorization can handle them. A nil
+// verifier disables token verification.
+func TokenAuthorization(verifier indieauth.Verifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if verifier == nil {
+				return next(c)
+			}
+
+			accessToken := indieauth.BearerToken(c.Request())
+			if accessToken == "" {
+				return next(c)
+			}
+
+			token, err := verifier.Verify(c.Request().Context(), accessToken)
+			if errors.Is(err, indieauth.ErrInvalidToken) {
+				return WriteError(c, Unauthorized("The access token is invalid or has expired"))
+			}
+			if err != nil {
+				return WriteError(c, ServerError("Failed to verify access token: "+err.Error()))
+			}
+
+			c.Set(tokenContextKey, token)
+			return next(c)
+		}
+	}
+}
+
+// TokenFromContext returns the verified access token of the request, or nil
+// when the request was not authorized with a token.
+func TokenFromContext(c echo.Context) *indieauth.Token {
+	token, _ := c.Get(tokenContextKey).(*indieauth.Token)
+	return token
+}
+
+// Scopes required by the Micropub actions.
+const (
+	ScopeCreate = "create"
+	ScopeUpdate = "update"
+	ScopeDelete = "delete"
+	ScopeMedia  = "media"
+	ScopeDraft  = "draft"
+)
+
+// requireScope returns an insufficient_scope error when the request was
+// authorized with an access token that lacks scope. Requests without a token
+// are authorized by role and always pass.
+func requireScope(c echo.Context, scope string) error {
+	token := TokenFromContext(c)
+	if token == nil || token.HasScope(scope) {
+		return nil
+	}
+	err := InsufficientScope(fmt.Sprintf("The access token does not have the '%s' scope", scope))
+	err.Scope = scope
+	return err
+}
+
+// applyClientDefaults adds the default properties configured for the client
+// of the access token to a create request, leaving properties sent by the
+// client alone.
+func applyClientDefaults(c echo.Context, content map[string]interface{}) {
+	token := TokenFromContext(c)
+	if token == nil || serverConfig == nil {
+		return
+	}
+	properties, ok := content["properties"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for name, values := range serverConfig.ClientDefaults[token.ClientID] {
+		if _, ok := properties[name]; !ok {
+			properties[name] = append([]interface{}(nil), values...)
+		}
+	}
+}
+
+// attributeRequest records the user and client of the access token in
+// content["me"] and content["client_id"], for commit attribution. Values sent
+// in the request body are dropped so they cannot be spoofed.
+func attributeRequest(c echo.Context, content map[string]interface{}) {
+	delete(content, "me")
+	delete(content, "client_id")
+	if token := TokenFromContext(c); token != nil {
+		content["me"] = token.Me
+		content["client_id"] = token.ClientID
+	}
+}
+
+// authorizeUpdate checks the scopes needed to update a post. Publishing a
+// draft through its post-status also needs the create scope, so tokens
+// limited to drafts cannot publish them.
+func authorizeUpdate(c echo.Context, content map[string]interface{}) error {
+	if err := requireScope(c, ScopeUpdate); err != nil {
+		return err
+	}
+
+	switch git.RequestedStatus(content) {
+	case "", git.StatusDraft:
+		return nil
+	case git.StatusPublished:
+		return requireScope(c, ScopeCreate)
+	default:
+		return InvalidRequest("post-status must be 'draft' or 'published'")
+	}
+}
+
+// authorizeCreate checks the scopes needed to create content. Tokens with only
+// the draft scope may create posts, which are then forced to be drafts.
+// Uploading files along with the post also needs the media scope.
+func authorizeCreate(c echo.Context, content map[string]interface{}) error {
+	if err := requireScope(c, ScopeCreate); err != nil {
+		if requireScope(c, ScopeDraft) != nil {
+			return err
+		}
+		if properties, ok := content["properties"].(map[string]interface{}); ok {
+			properties["post-status"] = []interface{}{"draft"}
+		}
+	}
+
+	if _, hasFiles := content["files"]; hasFiles {
+		return requireScope(c, ScopeMedia)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package micropub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/harperreed/micropub-service/internal/config"
+	"github.com/harperreed/micropub-service/internal/git"
+	"github.com/harperreed/micropub-service/internal/indieauth"
+	"github.com/labstack/echo/v5"
+)
+
+type MockVerifier struct {
+	Tokens map[string]*indieauth.Token
+	Err    error
+}
+
+func (m *MockVerifier) Verify(ctx context.Context, token string) (*indieauth.Token, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	if t, ok := m.Tokens[token]; ok {
+		return t, nil
+	}
+	return nil, indieauth.ErrInvalidToken
+}
+
+func TestTokenAuthorization(t *testing.T) {
+	e := echo.New()
+	verifier := &MockVerifier{Tokens: map[string]*indieauth.Token{
+		"valid": {Me: "https://example.com/", ClientID: "https://quill.p3k.io/", Scope: "create"},
+	}}
+
+	run := func(verifier indieauth.Verifier, authorization string) (*httptest.ResponseRecorder, *indieauth.Token, bool) {
+		req := httptest.NewRequest(http.MethodGet, "/micropub?q=config", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		var token *indieauth.Token
+		called := false
+		handler := TokenAuthorization(verifier)(func(c echo.Context) error {
+			called = true
+			token = TokenFromContext(c)
+			return c.NoContent(http.StatusOK)
+		})
+		if err := handler(c); err != nil {
+			t.Fatalf("middleware returned error: %v", err)
+		}
+		return rec, token, called
+	}
+
+	t.Run("ValidToken", func(t *testing.T) {
+		_, token, called := run(verifier, "Bearer valid")
+		if !called {
+			t.Fatalf("Expected next handler to be called")
+		}
+		if token == nil || token.ClientID != "https://quill.p3k.io/" {
+			t.Errorf("Expected token in context; got %+v", token)
+		}
+	})
+
+	t.Run("InvalidToken", func(t *testing.T) {
+		rec, _, called := run(verifier, "Bearer nope")
+		if called {
+			t.Errorf("Expected next handler not to be called")
+		}
+		assertMicropubError(t, rec, http.StatusUnauthorized, ErrUnauthorized)
+	})
+
+	t.Run("VerifierFailure", func(t *testing.T) {
+		rec, _, called := run(&MockVerifier{Err: errors.New("endpoint down")}, "Bearer valid")
+		if called {
+			t.Errorf("Expected next handler not to be called")
+		}
+		assertMicropubError(t, rec, http.StatusInternalServerError, ErrServerError)
+	})
+
+	t.Run("NoToken", func(t *testing.T) {
+		_, token, called := run(verifier, "")
+		if !called || token != nil {
+			t.Errorf("Expected request without token to pass through; called=%v token=%+v", called, token)
+		}
+	})
+
+	t.Run("NoVerifier", func(t *testing.T) {
+		_, token, called := run(nil, "Bearer valid")
+		if !called || token != nil {
+			t.Errorf("Expected request to pass through without verifier; called=%v token=%+v", called, token)
+		}
+	})
+}
+
+func TestScopeAuthorization(t *testing.T) {
+	e := echo.New()
+
+	mockGitOps := &MockGitOperations{}
+	originalGitOps := git.GitOps
+	git.GitOps = mockGitOps
+	defer func() { git.GitOps = originalGitOps }()
+
+	run := func(handler echo.HandlerFunc, scope, method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/micropub", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, "application/json")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(tokenContextKey, &indieauth.Token{Me: "https://example.com/", Scope: scope})
+		if err := handler(c); err != nil {
+			t.Fatalf("handler returned error: %v", err)
+		}
+		return rec
+	}
+
+	createBody := `{"type":["h-entry"],"properties":{"content":["Hello"]}}`
+	updateBody := `{"action":"update","url":"/post.md","replace":{"content":["Hi"]}}`
+	deleteBody := `{"action":"delete","url":"/post.md"}`
+	publishBody := `{"action":"update","url":"/post.md","replace":{"post-status":["published"]}}`
+
+	tests := []struct {
+		name    string
+		handler echo.HandlerFunc
+		method  string
+		body    string
+		scope   string
+		want    int
+	}{
+		{"CreateAllowed", HandleMicropubCreate, http.MethodPost, createBody, "create", http.StatusCreated},
+		{"CreateDenied", HandleMicropubCreate, http.MethodPost, createBody, "update delete", http.StatusUnauthorized},
+		{"UpdateAllowed", HandleMicropubUpdate, http.MethodPut, updateBody, "update", http.StatusOK},
+		{"UpdateDenied", HandleMicropubUpdate, http.MethodPut, updateBody, "create", http.StatusUnauthorized},
+		{"PublishAllowed", HandleMicropubUpdate, http.MethodPut, publishBody, "update create", http.StatusOK},
+		{"PublishDenied", HandleMicropubUpdate, http.MethodPut, publishBody, "update draft", http.StatusUnauthorized},
+		{"DeleteAllowed", HandleMicropubDelete, http.MethodDelete, deleteBody, "delete", http.StatusOK},
+		{"DeleteDenied", HandleMicropubDelete, http.MethodDelete, deleteBody, "create update", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := run(tt.handler, tt.scope, tt.method, tt.body)
+			if rec.Code != tt.want {
+				t.Fatalf("Expected status %v; got %v: %s", tt.want, rec.Code, rec.Body.String())
+			}
+			if tt.want == http.StatusUnauthorized {
+				assertMicropubError(t, rec, http.StatusUnauthorized, ErrInsufficientScope)
+			}
+		})
+	}
+
+	t.Run("DraftOnly", func(t *testing.T) {
+		rec := run(HandleMicropubCreate, "draft", http.MethodPost, createBody)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status Created; got %v", rec.Code)
+		}
+		properties := mockGitOps.LastContent["properties"].(map[string]interface{})
+		if status, _ := properties["post-status"].([]interface{}); len(status) != 1 || status[0] != "draft" {
+			t.Errorf("Expected post-status draft; got %v", properties["post-status"])
+		}
+	})
+
+	t.Run("InvalidStatus", func(t *testing.T) {
+		body := `{"action":"update","url":"/post.md","replace":{"post-status":["secret"]}}`
+		rec := run(HandleMicropubUpdate, "update create", http.MethodPut, body)
+		assertMicropubError(t, rec, http.StatusBadRequest, ErrInvalidRequest)
+	})
+
+	t.Run("ScopeInError", func(t *testing.T) {
+		rec := run(HandleMicropubUpdate, "create", http.MethodPut, updateBody)
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if body["scope"] != ScopeUpdate {
+			t.Errorf("Expected scope %q in error; got %q", ScopeUpdate, body["scope"])
+		}
+	})
+}
+
+func TestClientDefaults(t *testing.T) {
+	e := echo.New()
+
+	mockGitOps := &MockGitOperations{}
+	originalGitOps := git.GitOps
+	git.GitOps = mockGitOps
+	defer func() { git.GitOps = originalGitOps }()
+
+	originalConfig := serverConfig
+	serverConfig = &config.Config{ClientDefaults: map[string]map[string][]interface{}{
+		"https://quill.p3k.io/": {"post-status": {"draft"}, "category": {"quill"}},
+	}}
+	defer func() { serverConfig = originalConfig }()
+
+	run := func(clientID, body string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, "application/json")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set(tokenContextKey, &indieauth.Token{Me: "https://example.com/", ClientID: clientID, Scope: "create"})
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("handler returned error: %v", err)
+		}
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status Created; got %v: %s", rec.Code, rec.Body.String())
+		}
+		return mockGitOps.LastContent["properties"].(map[string]interface{})
+	}
+
+	t.Run("DefaultsApplied", func(t *testing.T) {
+		properties := run("https://quill.p3k.io/", `{"type":["h-entry"],"properties":{"content":["Hello"]}}`)
+		if status, _ := properties["post-status"].([]interface{}); len(status) != 1 || status[0] != "draft" {
+			t.Errorf("Expected post-status draft; got %v", properties["post-status"])
+		}
+		if category, _ := properties["category"].([]interface{}); len(category) != 1 || category[0] != "quill" {
+			t.Errorf("Expected category quill; got %v", properties["category"])
+		}
+	})
+
+	t.Run("ClientValuesKept", func(t *testing.T) {
+		properties := run("https://quill.p3k.io/", `{"type":["h-entry"],"properties":{"content":["Hello"],"post-status":["published"]}}`)
+		if status, _ := properties["post-status"].([]interface{}); len(status) != 1 || status[0] != "published" {
+			t.Errorf("Expected post-status published; got %v", properties["post-status"])
+		}
+	})
+
+	t.Run("OtherClient", func(t *testing.T) {
+		properties := run("https://indigenous.realize.be/", `{"type":["h-entry"],"properties":{"content":["Hello"]}}`)
+		if _, ok := properties["post-status"]; ok {
+			t.Errorf("Expected no post-status; got %v", properties["post-status"])
+		}
+	})
+}
+
+func TestAttributeRequest(t *testing.T) {
+	e := echo.New()
+
+	mockGitOps := &MockGitOperations{}
+	originalGitOps := git.GitOps
+	git.GitOps = mockGitOps
+	defer func() { git.GitOps = originalGitOps }()
+
+	body := `{"type":["h-entry"],"properties":{"content":["Hello"]},"me":"https://spoofed.example/","client_id":"https://spoofed.example/app"}`
+	run := func(token *indieauth.Token) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, "application/json")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if token != nil {
+			c.Set(tokenContextKey, token)
+		}
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("handler returned error: %v", err)
+		}
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status Created; got %v: %s", rec.Code, rec.Body.String())
+		}
+		return mockGitOps.LastContent
+	}
+
+	content := run(&indieauth.Token{Me: "https://example.com/", ClientID: "https://quill.p3k.io/", Scope: "create"})
+	if content["me"] != "https://example.com/" || content["client_id"] != "https://quill.p3k.io/" {
+		t.Errorf("Expected the user and client of the token; got me=%v client_id=%v", content["me"], content["client_id"])
+	}
+
+	content = run(nil)
+	if _, ok := content["me"]; ok {
+		t.Errorf("Expected me from the request body to be dropped; got %v", content["me"])
+	}
+	if _, ok := content["client_id"]; ok {
+		t.Errorf("Expected client_id from the request body to be dropped; got %v", content["client_id"])
+	}
+}
@@ -0,0 +1,76 @@
+package micropub
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+)
+
+// Error codes defined by the Micropub specification, plus server_error for
+// failures that are not the client's fault.
+const (
+	ErrInvalidRequest    = "invalid_request"
+	ErrUnauthorized      = "unauthorized"
+	ErrForbidden         = "forbidden"
+	ErrInsufficientScope = "insufficient_scope"
+	ErrServerError       = "server_error"
+)
+
+// Error is a Micropub error response. It is serialized as
+// {"error": "...", "error_description": "..."}.
+type Error struct {
+	Status      int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	// Scope is the scope needed to perform the request, set on
+	// insufficient_scope errors.
+	Scope string `json:"scope,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// NewError creates an Error with the given HTTP status, error code and description.
+func NewError(status int, code, description string) *Error {
+	return &Error{Status: status, Code: code, Description: description}
+}
+
+// InvalidRequest reports a malformed or unsupported request.
+func InvalidRequest(description string) *Error {
+	return NewError(http.StatusBadRequest, ErrInvalidRequest, description)
+}
+
+// Unauthorized reports a missing or invalid access token.
+func Unauthorized(description string) *Error {
+	return NewError(http.StatusUnauthorized, ErrUnauthorized, description)
+}
+
+// Forbidden reports an authenticated user who may not perform the request.
+func Forbidden(description string) *Error {
+	return NewError(http.StatusForbidden, ErrForbidden, description)
+}
+
+// InsufficientScope reports an access token lacking the scope the request needs.
+func InsufficientScope(description string) *Error {
+	return NewError(http.StatusUnauthorized, ErrInsufficientScope, description)
+}
+
+// ServerError reports an internal failure while handling the request.
+func ServerError(description string) *Error {
+	return NewError(http.StatusInternalServerError, ErrServerError, description)
+}
+
+// WriteError sends err as a Micropub JSON error response. Errors that are not
+// an *Error are reported as server errors.
+func WriteError(c echo.Context, err error) error {
+	var mpErr *Error
+	if !errors.As(err, &mpErr) {
+		mpErr = ServerError(err.Error())
+	}
+	return c.JSON(mpErr.Status, mpErr)
+}
@@ -1,10 +1,15 @@
 package micropub
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/harperreed/micropub-service/internal/git"
@@ -29,25 +34,115 @@ type PostEvent struct {
 
 var eventEmitter EventEmitter
 
+// internalKeys lists the keys that GitOperations use to pass state around and
+// report results, and that clients must not set. Clients only set the URL of
+// the post to update or delete.
+var internalKeys = []string{"path", "post-type", "media", "uploads", "pull_request", "queued", "url"}
+
+// removeInternalKeys deletes the internalKeys other than keep from content.
+func removeInternalKeys(content map[string]interface{}, keep ...string) {
+	for _, key := range internalKeys {
+		if !slices.Contains(keep, key) {
+			delete(content, key)
+		}
+	}
+}
+
+// HandleMicropubPost handles POST requests, which create posts or, with an
+// action, update, delete or undelete them.
+func HandleMicropubPost(c echo.Context) error {
+	content, err := parseContent(c)
+	if err != nil {
+		return WriteError(c, err)
+	}
+
+	switch content["action"] {
+	case nil, "", "create":
+		delete(content, "action")
+		return createPost(c, content)
+	case "update":
+		return updatePost(c, content)
+	case "delete", "undelete":
+		return deletePost(c, content)
+	default:
+		return WriteError(c, InvalidRequest(fmt.Sprintf("Unsupported action '%v'", content["action"])))
+	}
+}
+
+// RequestAction returns the action of a Micropub request, or "" for creates
+// and requests that cannot be parsed, without consuming the request body.
+func RequestAction(c echo.Context) string {
+	req := c.Request()
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/x-www-form-urlencoded":
+		if req.ParseForm() != nil {
+			return ""
+		}
+		return req.PostForm.Get("action")
+	case "multipart/form-data":
+		if req.ParseMultipartForm(maxUploadMemory) != nil {
+			return ""
+		}
+		return req.PostForm.Get("action")
+	case "application/json":
+		body, err := io.ReadAll(req.Body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return ""
+		}
+		var request struct {
+			Action string `json:"action"`
+		}
+		if json.Unmarshal(body, &request) != nil {
+			return ""
+		}
+		return request.Action
+	}
+	return ""
+}
+
 func HandleMicropubCreate(c echo.Context) error {
     content, err := parseContent(c)
     if err != nil {
-        return err
+        return WriteError(c, err)
     }
+    return createPost(c, content)
+}
+
+// createPost creates the post described by content.
+func createPost(c echo.Context, content map[string]interface{}) error {
+    // Where the post and its media are stored is decided by the server
+    removeInternalKeys(content)
 
     // Check if required fields are present
-    if content["type"] == nil || len(content["type"].([]interface{})) == 0 {
-        return echo.NewHTTPError(http.StatusBadRequest, "Missing 'type' field")
+    if types, ok := content["type"].([]interface{}); !ok || len(types) == 0 {
+        return WriteError(c, InvalidRequest("Missing 'type' field"))
     }
 
+    // Notes and articles need content; responses such as likes do not. Files
+    // uploaded with the request make it a photo, video or audio post.
     properties, ok := content["properties"].(map[string]interface{})
-    if !ok || properties["content"] == nil {
-        return echo.NewHTTPError(http.StatusBadRequest, "Missing or invalid 'content' field")
+    if !ok {
+        return WriteError(c, InvalidRequest("Missing or invalid 'properties' field"))
+    }
+    if postType := git.DiscoverPostType(content); properties["content"] == nil && !hasMediaUploads(content) && (postType == git.TypeNote || postType == git.TypeArticle) {
+        return WriteError(c, InvalidRequest("Missing or invalid 'content' field"))
     }
 
-    err = git.GitOps.CreatePost(content)
-    if err != nil {
-        return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create post: "+err.Error())
+    applyClientDefaults(c, content)
+    attributeRequest(c, content)
+
+    if err := authorizeCreate(c, content); err != nil {
+        return WriteError(c, err)
+    }
+
+    if err := collectUploads(content); err != nil {
+        return WriteError(c, err)
+    }
+
+    if err := git.GitOps.CreatePost(content); err != nil {
+        return WriteError(c, ServerError("Failed to create post: "+err.Error()))
     }
 
     if eventEmitter != nil {
@@ -58,52 +153,152 @@ func HandleMicropubCreate(c echo.Context) error {
         eventEmitter.Emit(PostEvent{Type: "create", PostID: postID})
     }
 
-    return c.String(http.StatusCreated, "Post created successfully")
+    status := http.StatusCreated
+    if queued, _ := content["queued"].(bool); queued {
+        status = http.StatusAccepted
+    }
+
+    if postURL, ok := content["url"].(string); ok && postURL != "" {
+        c.Response().Header().Set(echo.HeaderLocation, postLocation(postURL))
+    }
+
+    if prURL, ok := content["pull_request"].(string); ok {
+        return pullRequestOpened(c, prURL)
+    }
+
+    return c.String(status, "Post created successfully")
 }
 
 func HandleMicropubUpdate(c echo.Context) error {
     content, err := parseContent(c)
     if err != nil {
-        return err
+        return WriteError(c, err)
     }
+    return updatePost(c, content)
+}
 
+// updatePost applies the update request in content.
+func updatePost(c echo.Context, content map[string]interface{}) error {
     if content["action"] != "update" || content["url"] == nil {
-        return echo.NewHTTPError(http.StatusBadRequest, "Invalid update request")
+        return WriteError(c, InvalidRequest("Invalid update request"))
+    }
+    removeInternalKeys(content, "url")
+
+    if err := authorizeUpdate(c, content); err != nil {
+        return WriteError(c, err)
+    }
+    attributeRequest(c, content)
+
+    // Validate the 'replace', 'add' and 'delete' operations
+    _, hasReplace := content["replace"]
+    _, hasAdd := content["add"]
+    _, hasDelete := content["delete"]
+    if !hasReplace && !hasAdd && !hasDelete {
+        return WriteError(c, InvalidRequest("Update must include 'replace', 'add' or 'delete'"))
     }
 
-    // Handle 'replace' action
-    if replace, ok := content["replace"].(map[string]interface{}); ok {
-        for key, value := range replace {
-            if sliceValue, ok := value.([]interface{}); ok && len(sliceValue) > 0 {
-                replace[key] = sliceValue[0]
+    for _, operation := range []string{"replace", "add"} {
+        value, ok := content[operation]
+        if !ok {
+            continue
+        }
+        properties, ok := value.(map[string]interface{})
+        if !ok {
+            return WriteError(c, InvalidRequest(fmt.Sprintf("Invalid %s data", operation)))
+        }
+        for key, values := range properties {
+            if _, ok := values.([]interface{}); !ok {
+                return WriteError(c, InvalidRequest(fmt.Sprintf("Values of '%s' in %s must be an array", key, operation)))
+            }
+        }
+    }
+
+    if hasDelete {
+        switch remove := content["delete"].(type) {
+        case []interface{}:
+        case map[string]interface{}:
+            for key, values := range remove {
+                if _, ok := values.([]interface{}); !ok {
+                    return WriteError(c, InvalidRequest(fmt.Sprintf("Values of '%s' in delete must be an array", key)))
+                }
             }
+        default:
+            return WriteError(c, InvalidRequest("Invalid delete data"))
         }
-        content["properties"] = replace
-    } else {
-        return echo.NewHTTPError(http.StatusBadRequest, "Invalid replace data")
     }
 
-    err = git.GitOps.UpdatePost(content)
+    originalURL := content["url"]
+    err := git.GitOps.UpdatePost(content)
+    if errors.Is(err, git.ErrNotPost) {
+        return WriteError(c, InvalidRequest("Invalid 'url': "+err.Error()))
+    }
     if err != nil {
-        return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update post: "+err.Error())
+        return WriteError(c, ServerError("Failed to update post: "+err.Error()))
+    }
+
+    // Publishing a draft may move it; the new URL is returned with 201 Created
+    postURL, moved := content["url"].(string)
+    moved = moved && content["url"] != originalURL
+    if moved {
+        c.Response().Header().Set(echo.HeaderLocation, postLocation(postURL))
+    }
+    if prURL, ok := content["pull_request"].(string); ok {
+        return pullRequestOpened(c, prURL)
+    }
+    if moved {
+        return c.String(http.StatusCreated, "Post updated successfully")
     }
 
     return c.String(http.StatusOK, "Post updated successfully")
 }
 
+// HandleMicropubDelete handles the delete and undelete actions.
 func HandleMicropubDelete(c echo.Context) error {
 	content, err := parseContent(c)
 	if err != nil {
-		return err
+		return WriteError(c, err)
 	}
+	return deletePost(c, content)
+}
 
+// deletePost deletes or, with the undelete action, restores the post at
+// content["url"].
+func deletePost(c echo.Context, content map[string]interface{}) error {
 	if _, ok := content["url"]; !ok {
-		return echo.NewHTTPError(http.StatusBadRequest, "Missing URL for delete action")
+		return WriteError(c, InvalidRequest("Missing URL for delete action"))
+	}
+	removeInternalKeys(content, "url")
+
+	// Undeleting a post needs the same scope as deleting it
+	if err := requireScope(c, ScopeDelete); err != nil {
+		return WriteError(c, err)
+	}
+	attributeRequest(c, content)
+
+	if content["action"] == "undelete" {
+		err := git.GitOps.UndeletePost(content)
+		if errors.Is(err, git.ErrNotPost) {
+			return WriteError(c, InvalidRequest("Invalid 'url': "+err.Error()))
+		}
+		if err != nil {
+			return WriteError(c, ServerError("Failed to undelete post: "+err.Error()))
+		}
+		if prURL, ok := content["pull_request"].(string); ok {
+			return pullRequestOpened(c, prURL)
+		}
+
+		return c.String(http.StatusOK, "Post undeleted successfully")
 	}
 
-	err = git.GitOps.DeletePost(content)
+	err := git.GitOps.DeletePost(content)
+	if errors.Is(err, git.ErrNotPost) {
+		return WriteError(c, InvalidRequest("Invalid 'url': "+err.Error()))
+	}
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "Failed to delete post")
+		return WriteError(c, ServerError("Failed to delete post: "+err.Error()))
+	}
+	if prURL, ok := content["pull_request"].(string); ok {
+		return pullRequestOpened(c, prURL)
 	}
 
 	return c.String(http.StatusOK, "Post deleted successfully")
@@ -111,39 +306,63 @@ func HandleMicropubDelete(c echo.Context) error {
 
 func parseContent(c echo.Context) (map[string]interface{}, error) {
     req := c.Request()
-    contentType := req.Header.Get("Content-Type")
     var content map[string]interface{}
 
+    // ParseMediaType lowercases the media type and strips parameters such as charset
+    contentType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+    if err != nil {
+        return nil, NewError(http.StatusUnsupportedMediaType, ErrInvalidRequest, "Unsupported Content-Type")
+    }
+
     switch contentType {
     case "application/x-www-form-urlencoded":
     if err := req.ParseForm(); err != nil {
-        return nil, echo.NewHTTPError(http.StatusBadRequest, "Error parsing form data: "+err.Error())
-    }
-    content = make(map[string]interface{})
-    properties := make(map[string]interface{})
-    for key, values := range req.Form {
-        if key == "h" {
-            content["type"] = []interface{}{fmt.Sprintf("h-%s", values[0])}
-        } else if strings.HasSuffix(key, "[]") {
-            properties[strings.TrimSuffix(key, "[]")] = values
-        } else if len(values) == 1 {
-            properties[key] = values[0]
-        } else {
-            properties[key] = values
-        }
+        return nil, InvalidRequest("Error parsing form data: "+err.Error())
     }
-    content["properties"] = properties
+    content = formContent(req.Form)
+    case "multipart/form-data":
+        if err := req.ParseMultipartForm(maxUploadMemory); err != nil {
+            return nil, InvalidRequest("Error parsing multipart form data: "+err.Error())
+        }
+        content = formContent(req.MultipartForm.Value)
+        if len(req.MultipartForm.File) > 0 {
+            content["files"] = req.MultipartForm.File
+        }
     case "application/json":
         if err := json.NewDecoder(req.Body).Decode(&content); err != nil {
-            return nil, echo.NewHTTPError(http.StatusBadRequest, "Error parsing JSON: "+err.Error())
+            return nil, InvalidRequest("Error parsing JSON: "+err.Error())
         }
     default:
-        return nil, echo.NewHTTPError(http.StatusUnsupportedMediaType, "Unsupported Content-Type")
+        return nil, NewError(http.StatusUnsupportedMediaType, ErrInvalidRequest, "Unsupported Content-Type")
     }
 
     return content, nil
 }
 
+// formContent converts form-encoded Micropub fields into the JSON content structure.
+func formContent(form url.Values) map[string]interface{} {
+	content := make(map[string]interface{})
+	properties := make(map[string]interface{})
+	for key, values := range form {
+		if key == "access_token" {
+			// Sent by clients that cannot set the Authorization header
+			continue
+		} else if key == "h" {
+			content["type"] = []interface{}{fmt.Sprintf("h-%s", values[0])}
+		} else if key == "action" || key == "url" {
+			content[key] = values[0]
+		} else if strings.HasSuffix(key, "[]") {
+			properties[strings.TrimSuffix(key, "[]")] = values
+		} else if len(values) == 1 {
+			properties[key] = values[0]
+		} else {
+			properties[key] = values
+		}
+	}
+	content["properties"] = properties
+	return content
+}
+
 func parseFormToMap(form url.Values) map[string]interface{} {
 	result := make(map[string]interface{})
 	for key, values := range form {
@@ -156,6 +375,21 @@ func parseFormToMap(form url.Values) map[string]interface{} {
 	return result
 }
 
+// pullRequestOpened answers a request whose changes await review in a pull
+// request with 202 Accepted, linking to the pull request.
+func pullRequestOpened(c echo.Context, prURL string) error {
+	c.Response().Header().Add("Link", fmt.Sprintf("<%s>; rel=\"pull-request\"", prURL))
+	return c.String(http.StatusAccepted, "Pull request opened: "+prURL)
+}
+
+// postLocation returns the absolute URL of a post for the Location header.
+func postLocation(postURL string) string {
+	if serverConfig == nil {
+		return postURL
+	}
+	return serverConfig.PostURL(postURL)
+}
+
 // SetEventEmitter sets the event emitter for the package
 func SetEventEmitter(emitter EventEmitter) {
 	eventEmitter = emitter
@@ -1,17 +1,21 @@
 package micropub
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"mime/multipart"
 	"net/url"
-	// "os"
-	// "path/filepath"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	// "io/ioutil"
 
+	"github.com/harperreed/micropub-service/internal/config"
 	"github.com/harperreed/micropub-service/internal/git"
 	"github.com/labstack/echo/v5"
 )
@@ -20,6 +24,9 @@ type MockGitOperations struct {
     CreatePostError error
     UpdatePostError error
     DeletePostError error
+    UndeletePostError error
+    QueuePost       bool
+    PullRequest     string
     MockFileContent string
     LastContent     map[string]interface{}
 }
@@ -42,18 +49,32 @@ func (m *MockGitOperations) CreatePost(content map[string]interface{}) error {
 	if !ok {
 		return fmt.Errorf("invalid properties")
 	}
-	contentValue, ok := properties["content"]
+	if err := git.StoreUploads(content); err != nil {
+		return err
+	}
+	postType, ok := content["post-type"].(string)
 	if !ok {
+		postType = git.DiscoverPostType(content)
+	}
+	contentValue, ok := properties["content"]
+	if !ok && (postType == git.TypeNote || postType == git.TypeArticle) {
 		return fmt.Errorf("invalid content")
 	}
 	// Check if content is a string (form-encoded) or a slice (JSON)
-	if _, isString := contentValue.(string); !isString {
+	if _, isString := contentValue.(string); ok && !isString {
 		if contentSlice, isSlice := contentValue.([]interface{}); !isSlice || len(contentSlice) == 0 {
 			return fmt.Errorf("invalid content")
 		}
 	}
+	m.LastContent = content
 	// Simulate setting the URL
 	content["url"] = "https://example.com/new-post"
+	if m.QueuePost {
+		content["queued"] = true
+	}
+	if m.PullRequest != "" {
+		content["pull_request"] = m.PullRequest
+	}
 	return nil
 }
 
@@ -68,10 +89,11 @@ func (m *MockGitOperations) UpdatePost(content map[string]interface{}) error {
         return fmt.Errorf("invalid URL")
     }
 
-    properties, ok := content["properties"].(map[string]interface{})
+    properties, ok := content["replace"].(map[string]interface{})
     if !ok {
-        return fmt.Errorf("invalid properties data")
+        properties = map[string]interface{}{}
     }
+    m.LastContent = content
 
     // Instead of reading from a file, use the mock content
     existingContent := m.MockFileContent
@@ -121,6 +143,15 @@ func (m *MockGitOperations) DeletePost(content map[string]interface{}) error {
 	if m.DeletePostError != nil {
 		return m.DeletePostError
 	}
+	m.LastContent = content
+	return nil
+}
+
+func (m *MockGitOperations) UndeletePost(content map[string]interface{}) error {
+	if m.UndeletePostError != nil {
+		return m.UndeletePostError
+	}
+	m.LastContent = content
 	return nil
 }
 
@@ -245,6 +276,79 @@ func TestHandleMicropubCreate(t *testing.T) {
 		}
 	})
 
+	t.Run("LocationHeader", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(`{"type":["h-entry"],"properties":{"title":["Location Test"],"content":["Ahoy, world!"]}}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		SetConfig(&config.Config{PermalinkBase: "https://blog.example.com/"})
+		defer SetConfig(nil)
+
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
+		}
+
+		if rec.Code != http.StatusCreated {
+			t.Errorf("Expected status Created; got %v", rec.Code)
+		}
+
+		location := rec.Header().Get(echo.HeaderLocation)
+		if !strings.HasPrefix(location, "https://blog.example.com/") || !strings.HasSuffix(location, "-location-test.md") {
+			t.Errorf("Unexpected Location header %q", location)
+		}
+	})
+
+	t.Run("QueuedCreate", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(`{"type":["h-entry"],"properties":{"content":["Ahoy, world!"]}}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		originalGitOps := git.GitOps
+		git.GitOps = &MockGitOperations{QueuePost: true}
+		defer func() { git.GitOps = originalGitOps }()
+
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
+		}
+
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("Expected status Accepted; got %v", rec.Code)
+		}
+		if location := rec.Header().Get(echo.HeaderLocation); location != "https://example.com/new-post" {
+			t.Errorf("Expected Location %q; got %q", "https://example.com/new-post", location)
+		}
+	})
+
+	t.Run("PullRequestCreate", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(`{"type":["h-entry"],"properties":{"content":["Ahoy, world!"]}}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		originalGitOps := git.GitOps
+		git.GitOps = &MockGitOperations{PullRequest: "https://github.com/alice/blog/pull/1"}
+		defer func() { git.GitOps = originalGitOps }()
+
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
+		}
+
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("Expected status Accepted; got %v", rec.Code)
+		}
+		if location := rec.Header().Get(echo.HeaderLocation); location != "https://example.com/new-post" {
+			t.Errorf("Expected Location %q; got %q", "https://example.com/new-post", location)
+		}
+		if link := rec.Header().Get("Link"); link != `<https://github.com/alice/blog/pull/1>; rel="pull-request"` {
+			t.Errorf("Expected a Link to the pull request; got %q", link)
+		}
+		if !strings.Contains(rec.Body.String(), "https://github.com/alice/blog/pull/1") {
+			t.Errorf("Expected the pull request URL in the body; got %q", rec.Body.String())
+		}
+	})
+
 	t.Run("SuccessfulCreateWithoutURL", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(`{"type":["h-entry"],"properties":{"content":["Ahoy, world!"],"category":["test","micropub"]}}`))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -279,17 +383,10 @@ func TestHandleMicropubCreate(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		err := HandleMicropubCreate(c)
-		if err == nil {
-			t.Errorf("Expected error for invalid JSON, got nil")
-		}
-		if httperr, ok := err.(*echo.HTTPError); ok {
-			if httperr.Code != http.StatusBadRequest {
-				t.Errorf("Expected status BadRequest; got %v", httperr.Code)
-			}
-		} else {
-			t.Errorf("Expected *echo.HTTPError, got %T", err)
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
 		}
+		assertMicropubError(t, rec, http.StatusBadRequest, ErrInvalidRequest)
 	})
 
 	t.Run("SuccessfulCreateFormEncoded", func(t *testing.T) {
@@ -324,43 +421,166 @@ func TestHandleMicropubCreate(t *testing.T) {
     t.Logf("Content received by MockGitOperations: %+v", mockGitOps.LastContent)
 })
 
-	t.Run("MissingType", func(t *testing.T) {
-		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(`{"properties":{"content":["Ahoy, world!"]}}`))
+	t.Run("SuccessfulCreateMultipart", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("h", "entry")
+		writer.WriteField("content", "Look at this")
+		part, _ := writer.CreateFormFile("photo", "Sunset Photo.JPG")
+		part.Write([]byte("fake image content"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/micropub", body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockGitOps := &MockGitOperations{}
+		originalGitOps := git.GitOps
+		git.GitOps = mockGitOps
+		defer func() { git.GitOps = originalGitOps }()
+
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
+		}
+
+		if rec.Code != http.StatusCreated {
+			t.Errorf("Expected status Created; got %v", rec.Code)
+		}
+
+		media, _ := mockGitOps.LastContent["media"].([]string)
+		if len(media) != 1 {
+			t.Fatalf("Expected one media file; got %v", mockGitOps.LastContent["media"])
+		}
+		if _, err := os.Stat(filepath.Join(testDir, media[0])); err != nil {
+			t.Errorf("Uploaded file not stored: %v", err)
+		}
+
+		properties := mockGitOps.LastContent["properties"].(map[string]interface{})
+		photos, _ := properties["photo"].([]interface{})
+		if len(photos) != 1 || photos[0] != "/"+media[0] {
+			t.Errorf("Expected photo property to reference %q; got %v", media[0], properties["photo"])
+		}
+	})
+
+	// A photo needs no content, even though it is only known to be a photo
+	// once the upload is stored
+	t.Run("PhotoOnlyMultipart", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("h", "entry")
+		part, _ := writer.CreateFormFile("photo", "sunset.jpg")
+		part.Write([]byte("fake image content"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/micropub", body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockGitOps := &MockGitOperations{}
+		originalGitOps := git.GitOps
+		git.GitOps = mockGitOps
+		defer func() { git.GitOps = originalGitOps }()
+
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
+		}
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status Created; got %v: %s", rec.Code, rec.Body.String())
+		}
+		if postType := mockGitOps.LastContent["post-type"]; postType != git.TypePhoto {
+			t.Errorf("Expected a photo post; got %v", postType)
+		}
+	})
+
+	// Clients cannot choose where the post is written, nor what is reported
+	// back about it
+	t.Run("InternalKeysIgnored", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(`{"type":["h-entry"],"path":".git/hooks/pre-commit","post-type":"photo","pull_request":"https://evil.example/pr","queued":true,"properties":{"content":["Ahoy"]}}`))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		err := HandleMicropubCreate(c)
+		mockGitOps := &MockGitOperations{}
+		originalGitOps := git.GitOps
+		git.GitOps = mockGitOps
+		defer func() { git.GitOps = originalGitOps }()
 
-		if err == nil {
-			t.Errorf("Expected error for missing type, got nil")
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
 		}
-		if httperr, ok := err.(*echo.HTTPError); ok {
-			if httperr.Code != http.StatusBadRequest {
-				t.Errorf("Expected status BadRequest; got %v", httperr.Code)
+		for _, key := range []string{"path", "post-type", "pull_request", "queued"} {
+			if value, ok := mockGitOps.LastContent[key]; ok {
+				t.Errorf("Expected %s to be dropped; got %v", key, value)
 			}
-		} else {
-			t.Errorf("Expected *echo.HTTPError, got %T", err)
+		}
+		if rec.Code != http.StatusCreated || rec.Header().Get("Link") != "" {
+			t.Errorf("Expected 201 Created without a pull request; got %v, Link %q", rec.Code, rec.Header().Get("Link"))
 		}
 	})
 
+	t.Run("UnsupportedMultipartUpload", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("h", "entry")
+		writer.WriteField("content", "Look at this")
+		part, _ := writer.CreateFormFile("attachment", "notes.txt")
+		part.Write([]byte("text"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/micropub", body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
+		}
+		assertMicropubError(t, rec, http.StatusBadRequest, ErrInvalidRequest)
+	})
+
+	t.Run("MissingType", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(`{"properties":{"content":["Ahoy, world!"]}}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
+		}
+		assertMicropubError(t, rec, http.StatusBadRequest, ErrInvalidRequest)
+	})
+
 	t.Run("MissingContent", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(`{"type":["h-entry"],"properties":{}}`))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		err := HandleMicropubCreate(c)
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
+		}
+		assertMicropubError(t, rec, http.StatusBadRequest, ErrInvalidRequest)
+	})
+
+	t.Run("LikeWithoutContent", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(`{"type":["h-entry"],"properties":{"like-of":["https://example.com/liked"]}}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockGitOps := &MockGitOperations{}
+		originalGitOps := git.GitOps
+		git.GitOps = mockGitOps
+		defer func() { git.GitOps = originalGitOps }()
 
-		if err == nil {
-			t.Errorf("Expected error for missing content, got nil")
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
 		}
-		if httperr, ok := err.(*echo.HTTPError); ok {
-			if httperr.Code != http.StatusBadRequest {
-				t.Errorf("Expected status BadRequest; got %v", httperr.Code)
-			}
-		} else {
-			t.Errorf("Expected *echo.HTTPError, got %T", err)
+		if rec.Code != http.StatusCreated {
+			t.Errorf("Expected status Created; got %v: %s", rec.Code, rec.Body.String())
 		}
 	})
 
@@ -370,18 +590,10 @@ func TestHandleMicropubCreate(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		err := HandleMicropubCreate(c)
-
-		if err == nil {
-			t.Errorf("Expected error for unsupported content type, got nil")
-		}
-		if httperr, ok := err.(*echo.HTTPError); ok {
-			if httperr.Code != http.StatusUnsupportedMediaType {
-				t.Errorf("Expected status UnsupportedMediaType; got %v", httperr.Code)
-			}
-		} else {
-			t.Errorf("Expected *echo.HTTPError, got %T", err)
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
 		}
+		assertMicropubError(t, rec, http.StatusUnsupportedMediaType, ErrInvalidRequest)
 	})
 
 	t.Run("SuccessfulCreateWithEventEmitter", func(t *testing.T) {
@@ -440,17 +652,10 @@ func TestHandleMicropubCreate(t *testing.T) {
 		git.GitOps = &MockGitOperations{CreatePostError: errors.New("failed to create post")}
 		defer func() { git.GitOps = originalGitOps }()
 
-		err := HandleMicropubCreate(c)
-		if err == nil {
-			t.Errorf("Expected error, got nil")
-		}
-		if httperr, ok := err.(*echo.HTTPError); ok {
-			if httperr.Code != http.StatusInternalServerError {
-				t.Errorf("Expected status InternalServerError; got %v", httperr.Code)
-			}
-		} else {
-			t.Errorf("Expected *echo.HTTPError, got %T", err)
+		if err := HandleMicropubCreate(c); err != nil {
+			t.Fatalf("HandleMicropubCreate failed: %v", err)
 		}
+		assertMicropubError(t, rec, http.StatusInternalServerError, ErrServerError)
 	})
 }
 
@@ -461,18 +666,10 @@ func TestHandleMicropubUpdateInvalid(t *testing.T) {
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
 
-	err := HandleMicropubUpdate(c)
-
-	if err == nil {
-		t.Errorf("Expected error for invalid JSON, got nil")
-	}
-	if httperr, ok := err.(*echo.HTTPError); ok {
-		if httperr.Code != http.StatusBadRequest {
-			t.Errorf("Expected status BadRequest; got %v", httperr.Code)
-		}
-	} else {
-		t.Errorf("Expected *echo.HTTPError, got %T", err)
+	if err := HandleMicropubUpdate(c); err != nil {
+		t.Fatalf("HandleMicropubUpdate failed: %v", err)
 	}
+	assertMicropubError(t, rec, http.StatusBadRequest, ErrInvalidRequest)
 }
 
 func TestHandleMicropubDelete(t *testing.T) {
@@ -503,6 +700,71 @@ func TestHandleMicropubDelete(t *testing.T) {
 		}
 	})
 
+	t.Run("SuccessfulUndelete", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/micropub", strings.NewReader(`{"action":"undelete","url":"https://example.com/2023-05-01-test-post.md"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockGitOps := &MockGitOperations{}
+		originalGitOps := git.GitOps
+		git.GitOps = mockGitOps
+		defer func() { git.GitOps = originalGitOps }()
+
+		if err := HandleMicropubDelete(c); err != nil {
+			t.Fatalf("HandleMicropubDelete failed: %v", err)
+		}
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status OK; got %v", rec.Code)
+		}
+		if mockGitOps.LastContent == nil {
+			t.Errorf("Expected UndeletePost to be called")
+		}
+	})
+
+	t.Run("FormEncodedUndelete", func(t *testing.T) {
+		formData := url.Values{}
+		formData.Set("action", "undelete")
+		formData.Set("url", "https://example.com/2023-05-01-test-post.md")
+
+		// Micropub clients send form-encoded actions with POST
+		req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(formData.Encode()))
+		req.Header.Set(echo.HeaderContentType, "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockGitOps := &MockGitOperations{}
+		originalGitOps := git.GitOps
+		git.GitOps = mockGitOps
+		defer func() { git.GitOps = originalGitOps }()
+
+		if err := HandleMicropubDelete(c); err != nil {
+			t.Fatalf("HandleMicropubDelete failed: %v", err)
+		}
+
+		if mockGitOps.LastContent == nil || mockGitOps.LastContent["url"] != "https://example.com/2023-05-01-test-post.md" {
+			t.Errorf("Expected UndeletePost to be called with the URL; got %+v", mockGitOps.LastContent)
+		}
+	})
+
+	t.Run("UndeletePostError", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/micropub", strings.NewReader(`{"action":"undelete","url":"https://example.com/2023-05-01-test-post.md"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		originalGitOps := git.GitOps
+		git.GitOps = &MockGitOperations{UndeletePostError: errors.New("not in trash")}
+		defer func() { git.GitOps = originalGitOps }()
+
+		if err := HandleMicropubDelete(c); err != nil {
+			t.Fatalf("HandleMicropubDelete failed: %v", err)
+		}
+
+		assertMicropubError(t, rec, http.StatusInternalServerError, ErrServerError)
+	})
+
 	// Test case 2: Missing URL
 	t.Run("MissingURL", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodDelete, "/micropub", strings.NewReader(`{"action":"delete"}`))
@@ -510,21 +772,64 @@ func TestHandleMicropubDelete(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		err := HandleMicropubDelete(c)
-
-		if err == nil {
-			t.Errorf("Expected error for missing URL, got nil")
-		}
-		if httperr, ok := err.(*echo.HTTPError); ok {
-			if httperr.Code != http.StatusBadRequest {
-				t.Errorf("Expected status BadRequest; got %v", httperr.Code)
-			}
-		} else {
-			t.Errorf("Expected *echo.HTTPError, got %T", err)
+		if err := HandleMicropubDelete(c); err != nil {
+			t.Fatalf("HandleMicropubDelete failed: %v", err)
 		}
+		assertMicropubError(t, rec, http.StatusBadRequest, ErrInvalidRequest)
 	})
 }
 
+// Clients such as Quill send every action with POST
+func TestHandleMicropubPost(t *testing.T) {
+	e := echo.New()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantBody    string
+	}{
+		{"Create", echo.MIMEApplicationJSON, `{"type":["h-entry"],"properties":{"content":["Ahoy"]}}`, http.StatusCreated, "Post created successfully"},
+		{"Update", echo.MIMEApplicationJSON, `{"action":"update","url":"https://example.com/2023-05-01-test-post.md","replace":{"content":["Updated"]}}`, http.StatusOK, "Post updated successfully"},
+		{"Delete", echo.MIMEApplicationForm, "action=delete&url=https://example.com/2023-05-01-test-post.md", http.StatusOK, "Post deleted successfully"},
+		{"Undelete", echo.MIMEApplicationForm, "action=undelete&url=https://example.com/2023-05-01-test-post.md", http.StatusOK, "Post undeleted successfully"},
+		{"UnknownAction", echo.MIMEApplicationJSON, `{"action":"publish","url":"https://example.com/2023-05-01-test-post.md"}`, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, tt.contentType)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			if action := RequestAction(c); action != "" && !strings.Contains(tt.body, action) {
+				t.Errorf("RequestAction() = %q", action)
+			}
+
+			mockGitOps := &MockGitOperations{}
+			originalGitOps := git.GitOps
+			git.GitOps = mockGitOps
+			defer func() { git.GitOps = originalGitOps }()
+
+			if err := HandleMicropubPost(c); err != nil {
+				t.Fatalf("HandleMicropubPost failed: %v", err)
+			}
+			if tt.wantBody == "" {
+				assertMicropubError(t, rec, tt.wantStatus, ErrInvalidRequest)
+				return
+			}
+			if rec.Code != tt.wantStatus || strings.TrimSpace(rec.Body.String()) != tt.wantBody {
+				t.Errorf("Expected %v %q; got %v %q", tt.wantStatus, tt.wantBody, rec.Code, rec.Body.String())
+			}
+			if mockGitOps.LastContent == nil {
+				t.Errorf("Expected the post to be changed")
+			}
+		})
+	}
+}
+
 func TestHandleMicropubUpdateScenarios(t *testing.T) {
     e := echo.New()
 
@@ -583,20 +888,233 @@ func TestHandleMicropubUpdateScenarios(t *testing.T) {
 		git.GitOps = &MockGitOperations{UpdatePostError: errors.New("failed to update post")}
 		defer func() { git.GitOps = originalGitOps }()
 
-		err := HandleMicropubUpdate(c)
-		if err == nil {
-			t.Errorf("Expected error, got nil")
-		}
-		if httperr, ok := err.(*echo.HTTPError); ok {
-			if httperr.Code != http.StatusInternalServerError {
-				t.Errorf("Expected status InternalServerError; got %v", httperr.Code)
-			}
-		} else {
-			t.Errorf("Expected *echo.HTTPError, got %T", err)
+		if err := HandleMicropubUpdate(c); err != nil {
+			t.Fatalf("HandleMicropubUpdate failed: %v", err)
 		}
+		assertMicropubError(t, rec, http.StatusInternalServerError, ErrServerError)
 	})
 }
 
+// Clients of updates and deletes cannot fake the pull request or queue status
+// reported back to them
+func TestHandleMicropubInternalKeysIgnored(t *testing.T) {
+	e := echo.New()
+
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		handler echo.HandlerFunc
+	}{
+		{"Update", http.MethodPut, `{"action":"update","url":"https://example.com/2023-05-01-test-post.md","replace":{"content":["Updated"]},"path":"x.md","pull_request":"https://evil.example/pr","queued":true}`, HandleMicropubUpdate},
+		{"Delete", http.MethodDelete, `{"action":"delete","url":"https://example.com/2023-05-01-test-post.md","path":"x.md","pull_request":"https://evil.example/pr","queued":true}`, HandleMicropubDelete},
+		{"Undelete", http.MethodDelete, `{"action":"undelete","url":"https://example.com/2023-05-01-test-post.md","path":"x.md","pull_request":"https://evil.example/pr","queued":true}`, HandleMicropubDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/micropub", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			mockGitOps := &MockGitOperations{}
+			originalGitOps := git.GitOps
+			git.GitOps = mockGitOps
+			defer func() { git.GitOps = originalGitOps }()
+
+			if err := tt.handler(c); err != nil {
+				t.Fatalf("handler failed: %v", err)
+			}
+			if rec.Code != http.StatusOK || rec.Header().Get("Link") != "" {
+				t.Errorf("Expected 200 OK without a pull request; got %v, Link %q", rec.Code, rec.Header().Get("Link"))
+			}
+			for _, key := range []string{"path", "pull_request", "queued"} {
+				if value, ok := mockGitOps.LastContent[key]; ok {
+					t.Errorf("Expected %s to be dropped; got %v", key, value)
+				}
+			}
+			if mockGitOps.LastContent["url"] == nil {
+				t.Errorf("Expected the URL to be kept")
+			}
+		})
+	}
+}
+
+func TestHandleMicropubUpdateOperations(t *testing.T) {
+	e := echo.New()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "AddOnly",
+			body:       `{"action":"update","url":"https://example.com/post1","add":{"syndication":["https://mastodon.example/1"]}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "DeleteProperties",
+			body:       `{"action":"update","url":"https://example.com/post1","delete":["category"]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "DeleteValues",
+			body:       `{"action":"update","url":"https://example.com/post1","delete":{"category":["indieweb"]}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Combined",
+			body:       `{"action":"update","url":"https://example.com/post1","replace":{"title":["New"]},"add":{"category":["go"]},"delete":["location"]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "NoOperations",
+			body:       `{"action":"update","url":"https://example.com/post1"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "NonArrayValues",
+			body:       `{"action":"update","url":"https://example.com/post1","add":{"category":"go"}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "InvalidDelete",
+			body:       `{"action":"update","url":"https://example.com/post1","delete":"category"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/micropub", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			mockGitOps := &MockGitOperations{}
+			originalGitOps := git.GitOps
+			git.GitOps = mockGitOps
+			defer func() { git.GitOps = originalGitOps }()
+
+			err := HandleMicropubUpdate(c)
+			if err != nil {
+				t.Fatalf("HandleMicropubUpdate failed: %v", err)
+			}
+			if tt.wantStatus == http.StatusOK {
+				if mockGitOps.LastContent == nil {
+					t.Errorf("Expected UpdatePost to be called")
+				}
+				return
+			}
+
+			assertMicropubError(t, rec, tt.wantStatus, ErrInvalidRequest)
+		})
+	}
+}
+
+func TestParseContentContentTypes(t *testing.T) {
+	e := echo.New()
+
+	jsonBody := `{"type":["h-entry"],"properties":{"content":["Ahoy, world!"]}}`
+	formBody := "h=entry&content=Ahoy%2C+world%21"
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     bool
+	}{
+		{"JSON", "application/json", jsonBody, false},
+		{"JSONWithCharset", "application/json; charset=utf-8", jsonBody, false},
+		{"JSONWithUppercaseCharset", "application/json;charset=UTF-8", jsonBody, false},
+		{"JSONUppercase", "Application/JSON", jsonBody, false},
+		{"Form", "application/x-www-form-urlencoded", formBody, false},
+		{"FormWithCharset", "application/x-www-form-urlencoded; charset=UTF-8", formBody, false},
+		{"FormUppercase", "APPLICATION/X-WWW-FORM-URLENCODED", formBody, false},
+		{"Missing", "", jsonBody, true},
+		{"Malformed", "application/json; charset", jsonBody, true},
+		{"Unsupported", "text/plain; charset=utf-8", jsonBody, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set(echo.HeaderContentType, tt.contentType)
+			}
+			c := e.NewContext(req, httptest.NewRecorder())
+
+			content, err := parseContent(c)
+			if tt.wantErr {
+				var mpErr *Error
+				if !errors.As(err, &mpErr) || mpErr.Status != http.StatusUnsupportedMediaType {
+					t.Errorf("Expected UnsupportedMediaType error; got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseContent failed: %v", err)
+			}
+			properties, _ := content["properties"].(map[string]interface{})
+			if properties["content"] == nil {
+				t.Errorf("Expected content property; got %+v", content)
+			}
+		})
+	}
+}
+
+// assertMicropubError checks that rec holds a Micropub JSON error response.
+func assertMicropubError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	if rec.Code != status {
+		t.Errorf("Expected status %v; got %v", status, rec.Code)
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON error body, got %q: %v", rec.Body.String(), err)
+	}
+	if body["error"] != code {
+		t.Errorf("Expected error %q; got %q", code, body["error"])
+	}
+	if body["error_description"] == "" {
+		t.Errorf("Expected error_description to be set")
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	e := echo.New()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"InvalidRequest", InvalidRequest("bad"), http.StatusBadRequest, ErrInvalidRequest},
+		{"Unauthorized", Unauthorized("no token"), http.StatusUnauthorized, ErrUnauthorized},
+		{"Forbidden", Forbidden("nope"), http.StatusForbidden, ErrForbidden},
+		{"InsufficientScope", InsufficientScope("need create"), http.StatusUnauthorized, ErrInsufficientScope},
+		{"PlainError", errors.New("boom"), http.StatusInternalServerError, ErrServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+			if err := WriteError(c, tt.err); err != nil {
+				t.Fatalf("WriteError failed: %v", err)
+			}
+			assertMicropubError(t, rec, tt.wantStatus, tt.wantCode)
+		})
+	}
+}
+
 // Add this function
 func TestSetEventEmitter(t *testing.T) {
 	mockEmitter := &MockEventEmitter{}
@@ -0,0 +1,75 @@
+package micropub
+
+import (
+	"io"
+	"mime/multipart"
+	"strings"
+
+	"github.com/harperreed/micropub-service/internal/git"
+)
+
+// maxUploadMemory is the amount of a multipart request kept in memory; larger
+// uploads are spooled to temporary files.
+const maxUploadMemory = 32 << 20
+
+// uploadProperties lists the properties that accept inline file uploads.
+var uploadProperties = []string{"photo", "video", "audio"}
+
+// collectUploads records the files of a multipart request in
+// content["uploads"], for CreatePost to store in the media directory of the
+// post's layout and append their URLs to the matching properties.
+func collectUploads(content map[string]interface{}) error {
+	files, ok := content["files"].(map[string][]*multipart.FileHeader)
+	delete(content, "files")
+	if !ok || len(files) == 0 {
+		return nil
+	}
+
+	for name := range files {
+		if !isUploadProperty(name) {
+			return InvalidRequest("Unsupported file upload: " + name)
+		}
+	}
+
+	var uploads []git.Upload
+	for _, name := range uploadProperties {
+		var headers []*multipart.FileHeader
+		headers = append(headers, files[name]...)
+		headers = append(headers, files[name+"[]"]...)
+		for _, header := range headers {
+			header := header
+			uploads = append(uploads, git.Upload{
+				Property: name,
+				Filename: header.Filename,
+				Open: func() (io.ReadCloser, error) {
+					return header.Open()
+				},
+			})
+		}
+	}
+
+	content["uploads"] = uploads
+	return nil
+}
+
+// hasMediaUploads reports whether a multipart request uploads files for one of
+// uploadProperties.
+func hasMediaUploads(content map[string]interface{}) bool {
+	files, _ := content["files"].(map[string][]*multipart.FileHeader)
+	for name, headers := range files {
+		if len(headers) > 0 && isUploadProperty(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func isUploadProperty(name string) bool {
+	name = strings.TrimSuffix(name, "[]")
+	for _, property := range uploadProperties {
+		if name == property {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package micropub
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/harperreed/micropub-service/internal/config"
+	"github.com/harperreed/micropub-service/internal/git"
+	"github.com/labstack/echo/v5"
+)
+
+// supportedQueries lists the values of the q parameter understood by HandleMicropubQuery.
+var supportedQueries = []string{"config", "syndicate-to", "source"}
+
+var serverConfig *config.Config
+
+// HandleMicropubQuery answers GET requests to the Micropub endpoint.
+func HandleMicropubQuery(c echo.Context) error {
+	q := c.QueryParam("q")
+
+	switch q {
+	case "config":
+		return c.JSON(http.StatusOK, configResponse())
+	case "syndicate-to":
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"syndicate-to": syndicationTargets(),
+		})
+	case "source":
+		return handleSourceQuery(c)
+	case "":
+		return WriteError(c, InvalidRequest("Missing 'q' parameter"))
+	default:
+		return WriteError(c, InvalidRequest("Unsupported query: "+q))
+	}
+}
+
+func configResponse() map[string]interface{} {
+	response := map[string]interface{}{
+		"syndicate-to": syndicationTargets(),
+		"q":            supportedQueries,
+	}
+
+	cfg := serverConfig
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+
+	if cfg.MediaEndpoint != "" {
+		response["media-endpoint"] = cfg.MediaEndpoint
+	}
+	response["post-types"] = cfg.SupportedPostTypes()
+
+	return response
+}
+
+// handleSourceQuery returns the Microformats2 JSON of an existing post,
+// optionally limited to the properties listed in properties[].
+func handleSourceQuery(c echo.Context) error {
+	postURL := c.QueryParam("url")
+	if postURL == "" {
+		return WriteError(c, InvalidRequest("Missing 'url' parameter"))
+	}
+
+	frontmatter, body, err := git.ReadPost(postURL)
+	if err != nil {
+		if errors.Is(err, git.ErrNotPost) {
+			return WriteError(c, InvalidRequest("Invalid 'url': "+err.Error()))
+		}
+		if errors.Is(err, os.ErrNotExist) && git.IsDeleted(postURL) {
+			return WriteError(c, NewError(http.StatusGone, ErrInvalidRequest, "Post has been deleted: "+postURL))
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return WriteError(c, InvalidRequest("Post not found: "+postURL))
+		}
+		return WriteError(c, ServerError("Failed to read post: "+err.Error()))
+	}
+
+	properties := make(map[string]interface{}, len(frontmatter)+1)
+	for key, value := range frontmatter {
+		properties[git.PropertyName(key)] = propertyValues(value)
+	}
+	if body != "" {
+		properties["content"] = []interface{}{body}
+	}
+
+	params := c.QueryParams()
+	var requested []string
+	requested = append(requested, params["properties[]"]...)
+	requested = append(requested, params["properties"]...)
+	if len(requested) == 0 {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"type":       []string{"h-entry"},
+			"properties": properties,
+		})
+	}
+
+	filtered := make(map[string]interface{}, len(requested))
+	for _, name := range requested {
+		if value, ok := properties[name]; ok {
+			filtered[name] = value
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"properties": filtered,
+	})
+}
+
+// propertyValues wraps a frontmatter value in the array form used by Microformats2.
+func propertyValues(value interface{}) []interface{} {
+	if values, ok := value.([]interface{}); ok {
+		return values
+	}
+	return []interface{}{value}
+}
+
+func syndicationTargets() []config.SyndicationTarget {
+	if serverConfig == nil || serverConfig.SyndicateTo == nil {
+		return []config.SyndicationTarget{}
+	}
+	return serverConfig.SyndicateTo
+}
+
+// SetConfig sets the configuration used to answer queries
+func SetConfig(cfg *config.Config) {
+	serverConfig = cfg
+}
@@ -0,0 +1,207 @@
+package micropub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harperreed/micropub-service/internal/config"
+	"github.com/harperreed/micropub-service/internal/git"
+	"github.com/labstack/echo/v5"
+)
+
+func TestHandleMicropubQuery(t *testing.T) {
+	e := echo.New()
+
+	cfg := &config.Config{
+		GitRepoPath:   "/tmp/repo",
+		MediaEndpoint: "https://example.com/media",
+		SyndicateTo: []config.SyndicationTarget{
+			{UID: "https://mastodon.example/@me", Name: "Mastodon"},
+		},
+	}
+	SetConfig(cfg)
+	defer SetConfig(nil)
+
+	t.Run("Config", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/micropub?q=config", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if err := HandleMicropubQuery(c); err != nil {
+			t.Fatalf("HandleMicropubQuery failed: %v", err)
+		}
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status OK; got %v", rec.Code)
+		}
+
+		var body struct {
+			MediaEndpoint string                     `json:"media-endpoint"`
+			SyndicateTo   []config.SyndicationTarget `json:"syndicate-to"`
+			PostTypes     []config.PostType          `json:"post-types"`
+			Q             []string                   `json:"q"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		if body.MediaEndpoint != cfg.MediaEndpoint {
+			t.Errorf("Expected media-endpoint %q; got %q", cfg.MediaEndpoint, body.MediaEndpoint)
+		}
+		if len(body.SyndicateTo) != 1 || body.SyndicateTo[0].UID != "https://mastodon.example/@me" {
+			t.Errorf("Unexpected syndicate-to: %+v", body.SyndicateTo)
+		}
+		if len(body.PostTypes) != len(config.DefaultPostTypes) {
+			t.Errorf("Expected default post types; got %+v", body.PostTypes)
+		}
+		if len(body.Q) != len(supportedQueries) {
+			t.Errorf("Expected q %v; got %v", supportedQueries, body.Q)
+		}
+	})
+
+	t.Run("SyndicateTo", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/micropub?q=syndicate-to", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if err := HandleMicropubQuery(c); err != nil {
+			t.Fatalf("HandleMicropubQuery failed: %v", err)
+		}
+
+		var body map[string][]config.SyndicationTarget
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(body["syndicate-to"]) != 1 {
+			t.Errorf("Expected one syndication target; got %+v", body)
+		}
+	})
+
+	t.Run("UnsupportedQuery", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/micropub?q=unknown", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if err := HandleMicropubQuery(c); err != nil {
+			t.Fatalf("HandleMicropubQuery failed: %v", err)
+		}
+		assertMicropubError(t, rec, http.StatusBadRequest, ErrInvalidRequest)
+	})
+}
+
+func TestHandleMicropubSourceQuery(t *testing.T) {
+	e := echo.New()
+
+	testDir := t.TempDir()
+	originalRepoPath := git.RepoPath
+	git.RepoPath = testDir
+	defer func() { git.RepoPath = originalRepoPath }()
+
+	post := "---\ntitle: Source Post\ndate: 2023-05-01T12:00:00Z\ntags:\n- one\n- two\n---\n\nHello from the repository"
+	if err := os.WriteFile(filepath.Join(testDir, "2023-05-01-source-post.md"), []byte(post), 0644); err != nil {
+		t.Fatalf("Failed to create test post: %v", err)
+	}
+
+	query := func(target string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		return rec, HandleMicropubQuery(e.NewContext(req, rec))
+	}
+
+	t.Run("AllProperties", func(t *testing.T) {
+		rec, err := query("/micropub?q=source&url=https://example.com/2023-05-01-source-post.md")
+		if err != nil {
+			t.Fatalf("HandleMicropubQuery failed: %v", err)
+		}
+
+		var body struct {
+			Type       []string                 `json:"type"`
+			Properties map[string][]interface{} `json:"properties"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		if len(body.Type) != 1 || body.Type[0] != "h-entry" {
+			t.Errorf("Expected type h-entry; got %v", body.Type)
+		}
+		// The title frontmatter key is reported as the name property
+		if got := body.Properties["name"]; len(got) != 1 || got[0] != "Source Post" {
+			t.Errorf("Unexpected name: %v", got)
+		}
+		if got := body.Properties["tags"]; len(got) != 2 {
+			t.Errorf("Expected two tags; got %v", got)
+		}
+		if got := body.Properties["content"]; len(got) != 1 || got[0] != "Hello from the repository" {
+			t.Errorf("Unexpected content: %v", got)
+		}
+	})
+
+	t.Run("FilteredProperties", func(t *testing.T) {
+		rec, err := query("/micropub?q=source&url=https://example.com/2023-05-01-source-post.md&properties[]=name&properties[]=missing")
+		if err != nil {
+			t.Fatalf("HandleMicropubQuery failed: %v", err)
+		}
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		if _, ok := body["type"]; ok {
+			t.Errorf("Expected no type when properties are requested")
+		}
+		properties := body["properties"].(map[string]interface{})
+		if len(properties) != 1 || properties["name"] == nil {
+			t.Errorf("Expected only name; got %v", properties)
+		}
+	})
+
+	t.Run("MissingPost", func(t *testing.T) {
+		rec, err := query("/micropub?q=source&url=https://example.com/2023-05-01-nope.md")
+		if err != nil {
+			t.Fatalf("HandleMicropubQuery failed: %v", err)
+		}
+		assertMicropubError(t, rec, http.StatusBadRequest, ErrInvalidRequest)
+	})
+
+	t.Run("DeletedPost", func(t *testing.T) {
+		trashDir := filepath.Join(testDir, git.TrashDir)
+		if err := os.MkdirAll(trashDir, 0755); err != nil {
+			t.Fatalf("Failed to create trash directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(trashDir, "2023-05-01-deleted.md"), []byte(post), 0644); err != nil {
+			t.Fatalf("Failed to create deleted post: %v", err)
+		}
+
+		rec, err := query("/micropub?q=source&url=https://example.com/2023-05-01-deleted.md")
+		if err != nil {
+			t.Fatalf("HandleMicropubQuery failed: %v", err)
+		}
+		assertMicropubError(t, rec, http.StatusGone, ErrInvalidRequest)
+	})
+
+	// Files outside the layouts of posts, such as the Git configuration, are not served
+	t.Run("GitConfig", func(t *testing.T) {
+		if err := os.MkdirAll(filepath.Join(testDir, ".git"), 0755); err != nil {
+			t.Fatalf("Failed to create .git directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(testDir, ".git", "config"), []byte(post), 0644); err != nil {
+			t.Fatalf("Failed to create Git configuration: %v", err)
+		}
+
+		rec, err := query("/micropub?q=source&url=https://example.com/.git/config")
+		if err != nil {
+			t.Fatalf("HandleMicropubQuery failed: %v", err)
+		}
+		assertMicropubError(t, rec, http.StatusBadRequest, ErrInvalidRequest)
+		if strings.Contains(rec.Body.String(), "Hello from the repository") {
+			t.Errorf("Git configuration was served: %s", rec.Body.String())
+		}
+	})
+}
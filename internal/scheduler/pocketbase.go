@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Collection is the name of the PocketBase collection used by PocketBaseStore.
+const Collection = "scheduled_posts"
+
+// PocketBaseStore is a Store backed by a PocketBase collection, so that the
+// queue survives restarts. The collection has no API rules, so it is only
+// reachable by PocketBase admins.
+type PocketBaseStore struct {
+	app core.App
+}
+
+// NewPocketBaseStore creates a PocketBaseStore. Call EnsureCollection once the
+// app is bootstrapped and before using the store.
+func NewPocketBaseStore(app core.App) *PocketBaseStore {
+	return &PocketBaseStore{app: app}
+}
+
+// EnsureCollection creates the scheduled posts collection if it does not exist.
+func (s *PocketBaseStore) EnsureCollection() error {
+	if _, err := s.app.Dao().FindCollectionByNameOrId(Collection); err == nil {
+		return nil
+	}
+
+	collection := &models.Collection{
+		Name: Collection,
+		Type: models.CollectionTypeBase,
+		Schema: schema.NewSchema(
+			&schema.SchemaField{Name: "publish_at", Type: schema.FieldTypeDate, Required: true},
+			&schema.SchemaField{Name: "content", Type: schema.FieldTypeJson, Options: &schema.JsonOptions{MaxSize: 2 << 20}},
+			&schema.SchemaField{Name: "attempts", Type: schema.FieldTypeNumber},
+			&schema.SchemaField{Name: "last_error", Type: schema.FieldTypeText},
+		),
+	}
+	if err := s.app.Dao().SaveCollection(collection); err != nil {
+		return fmt.Errorf("failed to create %s collection: %w", Collection, err)
+	}
+	return nil
+}
+
+func (s *PocketBaseStore) Add(ctx context.Context, entry *Entry) error {
+	collection, err := s.app.Dao().FindCollectionByNameOrId(Collection)
+	if err != nil {
+		return err
+	}
+
+	record := models.NewRecord(collection)
+	record.Set("publish_at", entry.PublishAt)
+	record.Set("content", entry.Content)
+	record.Set("attempts", entry.Attempts)
+	record.Set("last_error", entry.LastError)
+	if err := s.app.Dao().SaveRecord(record); err != nil {
+		return err
+	}
+
+	entry.ID = record.Id
+	return nil
+}
+
+func (s *PocketBaseStore) Due(ctx context.Context, now time.Time) ([]*Entry, error) {
+	// The date is formatted by us, so it is safe to put in the filter
+	filter := fmt.Sprintf("publish_at <= '%s'", now.UTC().Format(types.DefaultDateLayout))
+	records, err := s.app.Dao().FindRecordsByFilter(Collection, filter, "publish_at", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0, len(records))
+	for _, record := range records {
+		var content map[string]interface{}
+		if err := record.UnmarshalJSONField("content", &content); err != nil {
+			return nil, fmt.Errorf("invalid content in scheduled post %s: %w", record.Id, err)
+		}
+		entries = append(entries, &Entry{
+			ID:        record.Id,
+			PublishAt: record.GetTime("publish_at"),
+			Content:   content,
+			Attempts:  record.GetInt("attempts"),
+			LastError: record.GetString("last_error"),
+		})
+	}
+	return entries, nil
+}
+
+func (s *PocketBaseStore) Update(ctx context.Context, entry *Entry) error {
+	record, err := s.findRecord(entry.ID)
+	if err != nil {
+		return err
+	}
+	record.Set("attempts", entry.Attempts)
+	record.Set("last_error", entry.LastError)
+	return s.app.Dao().SaveRecord(record)
+}
+
+func (s *PocketBaseStore) Remove(ctx context.Context, id string) error {
+	record, err := s.findRecord(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.app.Dao().DeleteRecord(record)
+}
+
+func (s *PocketBaseStore) findRecord(id string) (*models.Record, error) {
+	record, err := s.app.Dao().FindRecordById(Collection, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return record, err
+}
+
+// ensure PocketBaseStore satisfies Store
+var _ Store = (*PocketBaseStore)(nil)
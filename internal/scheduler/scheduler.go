@@ -0,0 +1,200 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/harperreed/micropub-service/internal/events"
+	"github.com/harperreed/micropub-service/internal/git"
+)
+
+// DefaultInterval is how often the queue is checked for due posts.
+const DefaultInterval = time.Minute
+
+// DefaultMaxAttempts is how many times publishing a post is attempted before
+// it is left in the queue for an admin to look at.
+const DefaultMaxAttempts = 5
+
+// Emitter emits events.
+type Emitter interface {
+	Emit(event interface{})
+}
+
+// Scheduler holds posts with a published date in the future in its Store and
+// publishes them through the wrapped GitOperations when the date comes.
+// Updates and deletes are passed through unchanged.
+type Scheduler struct {
+	git.GitOperations
+
+	// Store holds the queue of scheduled posts.
+	Store Store
+	// Emitter, when set, receives an events.PublishEvent for every post
+	// that goes live, and an events.PublishFailedEvent for every post that
+	// reaches MaxAttempts.
+	Emitter Emitter
+	// Interval is how often Run checks the queue.
+	Interval time.Duration
+	// MaxAttempts is how many times publishing a post is attempted.
+	MaxAttempts int
+
+	now func() time.Time
+	mu  sync.Mutex
+}
+
+// New creates a Scheduler publishing posts through ops.
+func New(ops git.GitOperations, store Store, emitter Emitter) *Scheduler {
+	return &Scheduler{
+		GitOperations: ops,
+		Store:         store,
+		Emitter:       emitter,
+		Interval:      DefaultInterval,
+		MaxAttempts:   DefaultMaxAttempts,
+		now:           time.Now,
+	}
+}
+
+// CreatePost queues posts with a published date in the future and sets
+// content["queued"], along with the URL the post will have. Other posts,
+// including drafts, are created right away.
+func (s *Scheduler) CreatePost(content map[string]interface{}) error {
+	properties, _ := content["properties"].(map[string]interface{})
+	publishAt, ok := git.PublishedTime(content)
+	if !ok || !publishAt.After(s.now()) || git.IsDraft(properties) {
+		return s.GitOperations.CreatePost(content)
+	}
+
+	// Store uploads now, as they cannot be queued, and plan the post so that
+	// its URL can be returned to the client
+	if err := git.StoreUploads(content); err != nil {
+		return err
+	}
+	if _, ok := content["path"].(string); !ok {
+		if _, err := git.PlanPost(content); err != nil {
+			return err
+		}
+	}
+
+	if err := s.Store.Add(context.Background(), &Entry{PublishAt: publishAt, Content: content}); err != nil {
+		if media, ok := content["media"].([]string); ok {
+			git.DiscardMedia(media)
+		}
+		return fmt.Errorf("failed to schedule post: %v", err)
+	}
+
+	content["url"] = git.PublicPath(content["path"].(string))
+	content["queued"] = true
+	return nil
+}
+
+// Run publishes due posts every Interval until ctx is done. Posts that came
+// due while the server was down are published on the first pass.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.PublishDue(ctx); err != nil {
+			log.Printf("Failed to publish scheduled posts: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishDue publishes the posts whose time has come. A post whose planned
+// path was taken in the meantime is planned again, so its URL may differ from
+// the one returned when it was queued. A post that fails to publish stays
+// queued and is retried on the next pass, up to MaxAttempts times.
+func (s *Scheduler) PublishDue(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.Store.Due(ctx, s.now())
+	if err != nil {
+		return fmt.Errorf("failed to read scheduled posts: %w", err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if entry.Attempts >= s.MaxAttempts {
+			continue
+		}
+
+		content := restoreContent(entry.Content)
+		if err := replanTaken(content); err != nil {
+			errs = append(errs, fmt.Errorf("post %s: %w", entry.ID, err))
+			continue
+		}
+		if err := s.GitOperations.CreatePost(content); err != nil {
+			entry.Attempts++
+			entry.LastError = err.Error()
+			if uerr := s.Store.Update(ctx, entry); uerr != nil {
+				errs = append(errs, uerr)
+			}
+			errs = append(errs, fmt.Errorf("post %s: %w", entry.ID, err))
+			if entry.Attempts >= s.MaxAttempts && s.Emitter != nil {
+				path, _ := content["path"].(string)
+				s.Emitter.Emit(events.PublishFailedEvent{
+					ID:       entry.ID,
+					URL:      git.PublicPath(path),
+					Attempts: entry.Attempts,
+					Error:    entry.LastError,
+				})
+			}
+			continue
+		}
+
+		if err := s.Store.Remove(ctx, entry.ID); err != nil {
+			errs = append(errs, fmt.Errorf("post %s was published but not removed from the queue: %w", entry.ID, err))
+		}
+
+		if s.Emitter != nil {
+			url, _ := content["url"].(string)
+			s.Emitter.Emit(events.PublishEvent{URL: url, PublishedAt: entry.PublishAt})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// replanTaken plans the path of a queued post again when another post was
+// created at the path planned for it.
+func replanTaken(content map[string]interface{}) error {
+	planned, ok := content["path"].(string)
+	if !ok {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(git.RepoPath, filepath.FromSlash(planned))); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := git.PlanPost(content); err != nil {
+		return err
+	}
+	log.Printf("Path %s of a scheduled post was taken, publishing it at %s instead", planned, content["path"])
+	return nil
+}
+
+// restoreContent turns the media paths of a create request read back from
+// JSON into the []string CreatePost expects.
+func restoreContent(content map[string]interface{}) map[string]interface{} {
+	if values, ok := content["media"].([]interface{}); ok {
+		media := make([]string, 0, len(values))
+		for _, value := range values {
+			if path, ok := value.(string); ok {
+				media = append(media, path)
+			}
+		}
+		content["media"] = media
+	}
+	return content
+}
@@ -0,0 +1,203 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/harperreed/micropub-service/internal/events"
+	"github.com/harperreed/micropub-service/internal/git"
+)
+
+type fakeGitOps struct {
+	git.GitOperations
+	created []map[string]interface{}
+	err     error
+}
+
+func (f *fakeGitOps) CreatePost(content map[string]interface{}) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.created = append(f.created, content)
+	content["url"] = "/" + content["path"].(string)
+	return nil
+}
+
+type fakeEmitter struct {
+	mu     sync.Mutex
+	events []interface{}
+}
+
+func (f *fakeEmitter) Emit(event interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+}
+
+func newPost(published string, extra map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{
+		"content":   []interface{}{"Hello from the future"},
+		"published": []interface{}{published},
+	}
+	for key, value := range extra {
+		properties[key] = value
+	}
+	return map[string]interface{}{
+		"type":       []interface{}{"h-entry"},
+		"properties": properties,
+		"path":       "future.md",
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	originalRepoPath := git.RepoPath
+	git.RepoPath = t.TempDir()
+	defer func() { git.RepoPath = originalRepoPath }()
+
+	now := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	newScheduler := func() (*Scheduler, *fakeGitOps, *MemoryStore, *fakeEmitter) {
+		ops, store, emitter := &fakeGitOps{}, NewMemoryStore(), &fakeEmitter{}
+		s := New(ops, store, emitter)
+		s.now = func() time.Time { return now }
+		return s, ops, store, emitter
+	}
+
+	t.Run("PastPostCreated", func(t *testing.T) {
+		s, ops, store, _ := newScheduler()
+		if err := s.CreatePost(newPost("2024-03-05T09:00:00Z", nil)); err != nil {
+			t.Fatalf("CreatePost() error = %v", err)
+		}
+		if len(ops.created) != 1 || store.Len() != 0 {
+			t.Errorf("Expected the post to be created right away; created %d, queued %d", len(ops.created), store.Len())
+		}
+	})
+
+	t.Run("DraftCreated", func(t *testing.T) {
+		s, ops, store, _ := newScheduler()
+		post := newPost("2024-03-06T09:00:00Z", map[string]interface{}{"post-status": []interface{}{"draft"}})
+		if err := s.CreatePost(post); err != nil {
+			t.Fatalf("CreatePost() error = %v", err)
+		}
+		if len(ops.created) != 1 || store.Len() != 0 {
+			t.Errorf("Expected the draft to be created right away; created %d, queued %d", len(ops.created), store.Len())
+		}
+	})
+
+	t.Run("FuturePostQueued", func(t *testing.T) {
+		s, ops, store, emitter := newScheduler()
+		post := newPost("2024-03-05T12:00:00Z", nil)
+		if err := s.CreatePost(post); err != nil {
+			t.Fatalf("CreatePost() error = %v", err)
+		}
+		if len(ops.created) != 0 || store.Len() != 1 {
+			t.Fatalf("Expected the post to be queued; created %d, queued %d", len(ops.created), store.Len())
+		}
+		if post["queued"] != true || post["url"] != "/future.md" {
+			t.Errorf("Expected queued post with URL; got queued=%v url=%v", post["queued"], post["url"])
+		}
+
+		if err := s.PublishDue(context.Background()); err != nil {
+			t.Fatalf("PublishDue() error = %v", err)
+		}
+		if len(ops.created) != 0 {
+			t.Fatalf("Expected the post to wait until it is due")
+		}
+
+		now = now.Add(3 * time.Hour)
+		defer func() { now = now.Add(-3 * time.Hour) }()
+		if err := s.PublishDue(context.Background()); err != nil {
+			t.Fatalf("PublishDue() error = %v", err)
+		}
+		if len(ops.created) != 1 || store.Len() != 0 {
+			t.Fatalf("Expected the post to be published; created %d, queued %d", len(ops.created), store.Len())
+		}
+
+		want := events.PublishEvent{URL: "/future.md", PublishedAt: time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)}
+		if len(emitter.events) != 1 || emitter.events[0] != want {
+			t.Errorf("Expected %v event; got %v", want, emitter.events)
+		}
+	})
+
+	t.Run("TakenPathReplanned", func(t *testing.T) {
+		s, ops, store, emitter := newScheduler()
+		entry := &Entry{PublishAt: now.Add(-time.Minute), Content: newPost("2024-03-05T09:59:00Z", nil)}
+		if err := store.Add(context.Background(), entry); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+
+		// Another post was created at the path planned for the queued one
+		taken := filepath.Join(git.RepoPath, "future.md")
+		if err := os.WriteFile(taken, []byte("Another post"), 0644); err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		defer os.Remove(taken)
+
+		if err := s.PublishDue(context.Background()); err != nil {
+			t.Fatalf("PublishDue() error = %v", err)
+		}
+		if len(ops.created) != 1 || store.Len() != 0 {
+			t.Fatalf("Expected the post to be published; created %d, queued %d", len(ops.created), store.Len())
+		}
+		if path := ops.created[0]["path"]; path == "future.md" || path == "" {
+			t.Errorf("Expected the post to be planned again; got path %v", path)
+		}
+		if event, ok := emitter.events[0].(events.PublishEvent); !ok || event.URL != ops.created[0]["url"] {
+			t.Errorf("Expected a publish event with the new URL; got %v", emitter.events)
+		}
+	})
+
+	t.Run("FailedPublishRetried", func(t *testing.T) {
+		s, ops, store, emitter := newScheduler()
+		s.MaxAttempts = 2
+		entry := &Entry{PublishAt: now.Add(-time.Minute), Content: newPost("2024-03-05T09:59:00Z", nil)}
+		if err := store.Add(context.Background(), entry); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+
+		ops.err = errors.New("push rejected")
+		for i := 0; i < 3; i++ {
+			s.PublishDue(context.Background())
+		}
+		due, _ := store.Due(context.Background(), now)
+		if len(due) != 1 || due[0].Attempts != 2 || due[0].LastError != "push rejected" {
+			t.Fatalf("Expected two failed attempts to be recorded; got %+v", due)
+		}
+		want := events.PublishFailedEvent{ID: entry.ID, URL: "/future.md", Attempts: 2, Error: "push rejected"}
+		if len(emitter.events) != 1 || emitter.events[0] != want {
+			t.Errorf("Expected %v event once the attempts ran out; got %v", want, emitter.events)
+		}
+
+		ops.err = nil
+		s.MaxAttempts = 3
+		if err := s.PublishDue(context.Background()); err != nil {
+			t.Fatalf("PublishDue() error = %v", err)
+		}
+		if len(ops.created) != 1 || store.Len() != 0 {
+			t.Errorf("Expected the post to be published on retry; created %d, queued %d", len(ops.created), store.Len())
+		}
+	})
+}
+
+func TestRestoreContent(t *testing.T) {
+	// Content read back from PocketBase has been through JSON
+	data, err := json.Marshal(map[string]interface{}{"media": []string{"media/a.jpg", "media/b.jpg"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content map[string]interface{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := restoreContent(content)
+	if want := []string{"media/a.jpg", "media/b.jpg"}; !reflect.DeepEqual(restored["media"], want) {
+		t.Errorf("restoreContent() media = %#v, want %#v", restored["media"], want)
+	}
+}
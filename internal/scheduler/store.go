@@ -0,0 +1,104 @@
+// Package scheduler holds posts with a published date in the future and
+// publishes them when that date comes.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Store when an entry does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Entry is a post waiting to be published.
+type Entry struct {
+	// ID identifies the entry in its Store.
+	ID string
+	// PublishAt is the time the post is published at.
+	PublishAt time.Time
+	// Content is the create request of the post, as passed to CreatePost.
+	Content map[string]interface{}
+	// Attempts counts the failed attempts to publish the post.
+	Attempts int
+	// LastError describes the last failed attempt.
+	LastError string
+}
+
+// Store persists the queue of scheduled posts.
+type Store interface {
+	// Add queues an entry and sets its ID.
+	Add(ctx context.Context, entry *Entry) error
+	// Due returns the entries to publish at or before now, oldest first.
+	Due(ctx context.Context, now time.Time) ([]*Entry, error)
+	// Update saves the attempts and last error of an entry.
+	Update(ctx context.Context, entry *Entry) error
+	// Remove deletes an entry from the queue.
+	Remove(ctx context.Context, id string) error
+}
+
+// MemoryStore is an in-memory Store, mainly useful for tests. Its queue does
+// not survive restarts.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+	nextID  int
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*Entry)}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, entry *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	entry.ID = strconv.Itoa(s.nextID)
+	copied := *entry
+	s.entries[entry.ID] = &copied
+	return nil
+}
+
+func (s *MemoryStore) Due(ctx context.Context, now time.Time) ([]*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*Entry
+	for _, entry := range s.entries {
+		if !entry.PublishAt.After(now) {
+			copied := *entry
+			due = append(due, &copied)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].PublishAt.Before(due[j].PublishAt) })
+	return due, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, entry *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.entries[entry.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Attempts = entry.Attempts
+	stored.LastError = entry.LastError
+	return nil
+}
+
+func (s *MemoryStore) Remove(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+	return nil
+}
+
+// Len returns the number of queued entries.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}